@@ -27,19 +27,39 @@ import (
 type AWSGatewaySpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonSpec `json:",inline"`
 
 	// Foo is an example field of AWSGateway. Edit AWSGateway_types.go to remove/update
 	Provider string `json:"provider,omitempty"`
-	VPC      string `json:"vpc,omitempty"`
-	ID       string `json:"id,omitempty"`
+	// VPC is the name of the AWSVPC of the internet gateway. Deprecated: use VPCRef.
+	VPC string `json:"vpc,omitempty"`
+	// VPCRef references the AWSVPC of the internet gateway
+	VPCRef *ResourceReference `json:"vpcRef,omitempty"`
+	// ID of the cloud resource, set once it's provisioned. An existing cloud
+	// resource is imported when its ID is set on creation.
+	ID string `json:"id,omitempty"`
+}
+
+// AWSGatewayObservation is the observed state of the internet gateway in the cloud
+type AWSGatewayObservation struct {
+	// OwnerID is the ID of the AWS account owning the internet gateway
+	OwnerID string `json:"ownerID,omitempty"`
 }
 
 // AWSGatewayStatus defines the observed state of AWSGateway
 type AWSGatewayStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// Lock is the lock on the Terraform state blocking the last reconcile
+	Lock *LockStatus `json:"lock,omitempty"`
+
+	// AtProvider is the observed state of the provisioned internet gateway
+	AtProvider *AWSGatewayObservation `json:"atProvider,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -63,6 +83,21 @@ type AWSGatewayList struct {
 	Items           []AWSGateway `json:"items"`
 }
 
+// GetVPCName returns the name of the AWSVPC of the internet gateway
+func (s *AWSGatewaySpec) GetVPCName() string {
+	return referenceName(s.VPCRef, s.VPC)
+}
+
+// GetID returns the ID of the provisioned internet gateway
+func (in *AWSGateway) GetID() string {
+	return in.Spec.ID
+}
+
+// GetCommonStatus returns the common status of the internet gateway
+func (in *AWSGateway) GetCommonStatus() *CommonStatus {
+	return &in.Status.CommonStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&AWSGateway{}, &AWSGatewayList{})
 }
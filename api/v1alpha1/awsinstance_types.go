@@ -27,23 +27,173 @@ import (
 type AWSInstanceSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonSpec `json:",inline"`
 
 	// Foo is an example field of AWSInstance. Edit AWSInstance_types.go to remove/update
 	Provider string `json:"provider,omitempty"`
-	Subnet   string `json:"subnet,omitempty"`
-	SG       string `json:"sg,omitempty"`
-	ID       string `json:"id,omitempty"`
-	Image    string `json:"image,omitempty"`
-	Type     string `json:"type,omitempty"`
-	Key      string `json:"key,omitempty"`
+	// Subnet and SG are the names of the AWSSubnet and an AWSSecurityGroup of
+	// the instance. Deprecated: use SubnetRef and SecurityGroupRefs.
+	Subnet string `json:"subnet,omitempty"`
+	SG     string `json:"sg,omitempty"`
+	// SubnetRef references the AWSSubnet of the instance
+	SubnetRef *ResourceReference `json:"subnetRef,omitempty"`
+	// SecurityGroupRefs reference the AWSSecurityGroups of the instance
+	SecurityGroupRefs []ResourceReference `json:"securityGroupRefs,omitempty"`
+	// ID of the cloud resource, set once it's provisioned. An existing cloud
+	// resource is imported when its ID is set on creation.
+	ID    string `json:"id,omitempty"`
+	Image string `json:"image,omitempty"`
+	Type  string `json:"type,omitempty"`
+	Key   string `json:"key,omitempty"`
+
+	// SGs are the names of more AWSSecurityGroups of the instance, besides
+	// SG. Deprecated: use SecurityGroupRefs.
+	SGs []string `json:"sgs,omitempty"`
+
+	// Replicas is the number of instances, 1 by default
+	// +kubebuilder:validation:Minimum=1
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// UserData is the script run by the instance on boot
+	UserData string `json:"userData,omitempty"`
+
+	// UserDataFrom reads the user data from a ConfigMap, instead of UserData
+	UserDataFrom *ConfigMapKeyReference `json:"userDataFrom,omitempty"`
+
+	// RootVolume configures the root EBS volume of the instance
+	RootVolume *AWSVolume `json:"rootVolume,omitempty"`
+
+	// Volumes are the EBS volumes attached to the instance besides the root
+	// volume
+	Volumes []AWSVolume `json:"volumes,omitempty"`
+
+	// Tags of the instance. The Name tag defaults to the name of the
+	// resource, with the index of the instance when there are replicas.
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// IAMInstanceProfile is the name of the IAM instance profile of the
+	// instance
+	IAMInstanceProfile string `json:"iamInstanceProfile,omitempty"`
+
+	// AssociatePublicIP associates a public IP address with the instance,
+	// true by default
+	AssociatePublicIP *bool `json:"associatePublicIP,omitempty"`
+
+	// PrivateIP is the private IP address of the instance in its subnet. It
+	// can only be set for a single replica.
+	PrivateIP string `json:"privateIP,omitempty"`
+
+	// WriteConnectionSecretToRef is the Secret where the IP addresses and DNS
+	// names of the instance are written. It's owned by the resource and
+	// updated on every apply.
+	WriteConnectionSecretToRef *ConnectionSecretReference `json:"writeConnectionSecretToRef,omitempty"`
+}
+
+// AWSVolume is an EBS volume of an instance
+type AWSVolume struct {
+	// DeviceName is the name of the device to mount, e.g. /dev/sdh. It's
+	// required by the volumes besides the root volume.
+	DeviceName string `json:"deviceName,omitempty"`
+
+	// Size of the volume in GiB
+	Size int32 `json:"size,omitempty"`
+
+	// Type of the volume, e.g. gp2, io1 or standard
+	Type string `json:"type,omitempty"`
+
+	// Encrypted enables the encryption of the volume
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// DeleteOnTermination deletes the volume when the instance is
+	// terminated, true by default
+	DeleteOnTermination *bool `json:"deleteOnTermination,omitempty"`
+}
+
+// GetReplicas returns the number of instances
+func (s *AWSInstanceSpec) GetReplicas() int32 {
+	if s.Replicas == nil {
+		return 1
+	}
+	return *s.Replicas
+}
+
+// GetSGs returns the names of all the security groups of the instance
+func (s *AWSInstanceSpec) GetSGs() []string {
+	sgs := []string{}
+	if s.SG != "" {
+		sgs = append(sgs, s.SG)
+	}
+	for _, sg := range s.SGs {
+		if sg != s.SG {
+			sgs = append(sgs, sg)
+		}
+	}
+	for _, ref := range s.SecurityGroupRefs {
+		sgs = append(sgs, ref.Name)
+	}
+	return sgs
+}
+
+// GetSubnetName returns the name of the AWSSubnet of the instance
+func (s *AWSInstanceSpec) GetSubnetName() string {
+	return referenceName(s.SubnetRef, s.Subnet)
+}
+
+// GetAssociatePublicIP returns whether a public IP address is associated
+// with the instance
+func (s *AWSInstanceSpec) GetAssociatePublicIP() bool {
+	return s.AssociatePublicIP == nil || *s.AssociatePublicIP
+}
+
+// GetDeleteOnTermination returns whether the volume is deleted when the
+// instance is terminated
+func (v *AWSVolume) GetDeleteOnTermination() bool {
+	return v.DeleteOnTermination == nil || *v.DeleteOnTermination
+}
+
+// AWSInstanceObservation is the observed state of the instance in the cloud
+type AWSInstanceObservation struct {
+	// ARN of the instance
+	ARN string `json:"arn,omitempty"`
+
+	// InstanceState is the state of the instance, e.g. running
+	InstanceState    string `json:"instanceState,omitempty"`
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+
+	// Addresses of the instance
+	PrivateIP  string `json:"privateIP,omitempty"`
+	PrivateDNS string `json:"privateDNS,omitempty"`
+	PublicIP   string `json:"publicIP,omitempty"`
+	PublicDNS  string `json:"publicDNS,omitempty"`
+}
+
+// AWSInstanceNode is a provisioned instance of the replicas
+type AWSInstanceNode struct {
+	// ID of the instance
+	ID string `json:"id"`
+
+	// InstanceState is the state of the instance, e.g. running
+	InstanceState string `json:"instanceState,omitempty"`
+
+	PrivateIP string `json:"privateIP,omitempty"`
+	PublicIP  string `json:"publicIP,omitempty"`
 }
 
 // AWSInstanceStatus defines the observed state of AWSInstance
 type AWSInstanceStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
-	Nodes []string `json:"nodes,omitempty"`
-	Phase string   `json:"phase,omitempty"`
+	CommonStatus `json:",inline"`
+
+	// Nodes are the provisioned instances, ordered by index
+	Nodes []AWSInstanceNode `json:"nodes,omitempty"`
+	Phase string            `json:"phase,omitempty"`
+
+	// Lock is the lock on the Terraform state blocking the last reconcile
+	Lock *LockStatus `json:"lock,omitempty"`
+
+	// AtProvider is the observed state of the provisioned instance
+	AtProvider *AWSInstanceObservation `json:"atProvider,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -67,6 +217,16 @@ type AWSInstanceList struct {
 	Items           []AWSInstance `json:"items"`
 }
 
+// GetID returns the ID of the provisioned instance
+func (in *AWSInstance) GetID() string {
+	return in.Spec.ID
+}
+
+// GetCommonStatus returns the common status of the instance
+func (in *AWSInstance) GetCommonStatus() *CommonStatus {
+	return &in.Status.CommonStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&AWSInstance{}, &AWSInstanceList{})
 }
@@ -27,18 +27,110 @@ import (
 type AWSKeySpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonSpec `json:",inline"`
 
 	// Foo is an example field of AWSKey. Edit AWSKey_types.go to remove/update
 	Provider string `json:"provider,omitempty"`
-	ID       string `json:"id,omitempty"`
+	// ID of the cloud resource, set once it's provisioned. An existing cloud
+	// resource is imported when its ID is set on creation.
+	ID string `json:"id,omitempty"`
+
+	// PublicKey is the OpenSSH public key of an existing key to register,
+	// instead of generating a key
+	PublicKey string `json:"publicKey,omitempty"`
+
+	// PublicKeySecretRef is the Secret holding the OpenSSH public key of an
+	// existing key to register, in its `publicKey` key by default
+	PublicKeySecretRef *SecretKeyReference `json:"publicKeySecretRef,omitempty"`
+
+	// Algorithm of the generated key, RSA by default
+	Algorithm KeyAlgorithm `json:"algorithm,omitempty"`
+
+	// KeySize of the generated key. It's the number of bits of an RSA key,
+	// 4096 by default, or the size of the curve of an ECDSA key: 224, 256,
+	// 384 or 521, 256 by default.
+	KeySize int `json:"keySize,omitempty"`
+
+	// WriteConnectionSecretToRef is the Secret where the private and public
+	// keys of the key pair are written. It's owned by the resource and updated
+	// on every apply. A generated key is written to the Secret
+	// `<name>-ssh-key` when it's not set.
+	WriteConnectionSecretToRef *ConnectionSecretReference `json:"writeConnectionSecretToRef,omitempty"`
+}
+
+// KeyAlgorithm is the algorithm of a generated key
+// +kubebuilder:validation:Enum=RSA;ECDSA
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmRSA   KeyAlgorithm = "RSA"
+	KeyAlgorithmECDSA KeyAlgorithm = "ECDSA"
+)
+
+// Default key sizes of the generated keys
+const (
+	DefaultRSAKeySize   = 4096
+	DefaultECDSAKeySize = 256
+)
+
+// PublicKeySecretKey is the default key of the public key in a Secret
+const PublicKeySecretKey = "publicKey"
+
+// GeneratesKey returns true if the key is generated, not registered from an
+// existing public key
+func (s *AWSKeySpec) GeneratesKey() bool {
+	return s.PublicKey == "" && s.PublicKeySecretRef == nil
+}
+
+// GetAlgorithm returns the algorithm of the generated key, or the default one
+func (s *AWSKeySpec) GetAlgorithm() KeyAlgorithm {
+	if s.Algorithm == "" {
+		return KeyAlgorithmRSA
+	}
+	return s.Algorithm
+}
+
+// GetKeySize returns the size of the generated key, or the default size of
+// its algorithm
+func (s *AWSKeySpec) GetKeySize() int {
+	if s.KeySize != 0 {
+		return s.KeySize
+	}
+	if s.GetAlgorithm() == KeyAlgorithmECDSA {
+		return DefaultECDSAKeySize
+	}
+	return DefaultRSAKeySize
+}
+
+// GetWriteConnectionSecretToRef returns the Secret where the connection details
+// of the key are written, if any
+func (k *AWSKey) GetWriteConnectionSecretToRef() *ConnectionSecretReference {
+	if k.Spec.WriteConnectionSecretToRef == nil && k.Spec.GeneratesKey() {
+		return &ConnectionSecretReference{Name: k.Name + "-ssh-key"}
+	}
+	return k.Spec.WriteConnectionSecretToRef
+}
+
+// AWSKeyObservation is the observed state of the key pair in the cloud
+type AWSKeyObservation struct {
+	// Fingerprint of the public key
+	Fingerprint string `json:"fingerprint,omitempty"`
 }
 
 // AWSKeyStatus defines the observed state of AWSKey
 type AWSKeyStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// Lock is the lock on the Terraform state blocking the last reconcile
+	Lock *LockStatus `json:"lock,omitempty"`
+
+	// AtProvider is the observed state of the provisioned key pair
+	AtProvider *AWSKeyObservation `json:"atProvider,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -62,6 +154,16 @@ type AWSKeyList struct {
 	Items           []AWSKey `json:"items"`
 }
 
+// GetID returns the ID of the provisioned key pair
+func (in *AWSKey) GetID() string {
+	return in.Spec.ID
+}
+
+// GetCommonStatus returns the common status of the key pair
+func (in *AWSKey) GetCommonStatus() *CommonStatus {
+	return &in.Status.CommonStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&AWSKey{}, &AWSKeyList{})
 }
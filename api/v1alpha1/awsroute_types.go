@@ -27,22 +27,47 @@ import (
 type AWSRouteSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonSpec `json:",inline"`
 
 	// Foo is an example field of AWSRoute. Edit AWSRoute_types.go to remove/update
 	Provider string `json:"provider,omitempty"`
-	VPC      string `json:"vpc,omitempty"`
-	Subnet   string `json:"subnet,omitempty"`
-	Gateway  string `json:"gateway,omitempty"`
-	ID       string `json:"id,omitempty"`
-	CIDR     string `json:"cidr,omitempty"`
+	// VPC, Subnet and Gateway are the names of the AWSVPC, AWSSubnet and
+	// AWSGateway of the route table. Deprecated: use the references.
+	VPC     string `json:"vpc,omitempty"`
+	Subnet  string `json:"subnet,omitempty"`
+	Gateway string `json:"gateway,omitempty"`
+	// VPCRef references the AWSVPC of the route table
+	VPCRef *ResourceReference `json:"vpcRef,omitempty"`
+	// SubnetRef references the AWSSubnet associated with the route table
+	SubnetRef *ResourceReference `json:"subnetRef,omitempty"`
+	// GatewayRef references the AWSGateway the route table routes to
+	GatewayRef *ResourceReference `json:"gatewayRef,omitempty"`
+	// ID of the cloud resource, set once it's provisioned. An existing cloud
+	// resource is imported when its ID is set on creation.
+	ID   string `json:"id,omitempty"`
+	CIDR string `json:"cidr,omitempty"`
+}
+
+// AWSRouteObservation is the observed state of the route table in the cloud
+type AWSRouteObservation struct {
+	// OwnerID is the ID of the AWS account owning the route table
+	OwnerID string `json:"ownerID,omitempty"`
 }
 
 // AWSRouteStatus defines the observed state of AWSRoute
 type AWSRouteStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// Lock is the lock on the Terraform state blocking the last reconcile
+	Lock *LockStatus `json:"lock,omitempty"`
+
+	// AtProvider is the observed state of the provisioned route table
+	AtProvider *AWSRouteObservation `json:"atProvider,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -66,6 +91,31 @@ type AWSRouteList struct {
 	Items           []AWSRoute `json:"items"`
 }
 
+// GetVPCName returns the name of the AWSVPC of the route table
+func (s *AWSRouteSpec) GetVPCName() string {
+	return referenceName(s.VPCRef, s.VPC)
+}
+
+// GetSubnetName returns the name of the AWSSubnet of the route table
+func (s *AWSRouteSpec) GetSubnetName() string {
+	return referenceName(s.SubnetRef, s.Subnet)
+}
+
+// GetGatewayName returns the name of the AWSGateway of the route table
+func (s *AWSRouteSpec) GetGatewayName() string {
+	return referenceName(s.GatewayRef, s.Gateway)
+}
+
+// GetID returns the ID of the provisioned route table
+func (in *AWSRoute) GetID() string {
+	return in.Spec.ID
+}
+
+// GetCommonStatus returns the common status of the route table
+func (in *AWSRoute) GetCommonStatus() *CommonStatus {
+	return &in.Status.CommonStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&AWSRoute{}, &AWSRouteList{})
 }
@@ -27,19 +27,42 @@ import (
 type AWSSecurityGroupSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonSpec `json:",inline"`
 
 	// Foo is an example field of AWSSecurityGroup. Edit AWSSecurityGroup_types.go to remove/update
 	Provider string `json:"provider,omitempty"`
-	VPC      string `json:"vpc,omitempty"`
-	ID       string `json:"id,omitempty"`
+	// VPC is the name of the AWSVPC of the security group. Deprecated: use VPCRef.
+	VPC string `json:"vpc,omitempty"`
+	// VPCRef references the AWSVPC of the security group
+	VPCRef *ResourceReference `json:"vpcRef,omitempty"`
+	// ID of the cloud resource, set once it's provisioned. An existing cloud
+	// resource is imported when its ID is set on creation.
+	ID string `json:"id,omitempty"`
+}
+
+// AWSSecurityGroupObservation is the observed state of the security group in the cloud
+type AWSSecurityGroupObservation struct {
+	// ARN of the security group
+	ARN string `json:"arn,omitempty"`
+
+	// OwnerID is the ID of the AWS account owning the security group
+	OwnerID string `json:"ownerID,omitempty"`
 }
 
 // AWSSecurityGroupStatus defines the observed state of AWSSecurityGroup
 type AWSSecurityGroupStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// Lock is the lock on the Terraform state blocking the last reconcile
+	Lock *LockStatus `json:"lock,omitempty"`
+
+	// AtProvider is the observed state of the provisioned security group
+	AtProvider *AWSSecurityGroupObservation `json:"atProvider,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -63,6 +86,21 @@ type AWSSecurityGroupList struct {
 	Items           []AWSSecurityGroup `json:"items"`
 }
 
+// GetVPCName returns the name of the AWSVPC of the security group
+func (s *AWSSecurityGroupSpec) GetVPCName() string {
+	return referenceName(s.VPCRef, s.VPC)
+}
+
+// GetID returns the ID of the provisioned security group
+func (in *AWSSecurityGroup) GetID() string {
+	return in.Spec.ID
+}
+
+// GetCommonStatus returns the common status of the security group
+func (in *AWSSecurityGroup) GetCommonStatus() *CommonStatus {
+	return &in.Status.CommonStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&AWSSecurityGroup{}, &AWSSecurityGroupList{})
 }
@@ -27,24 +27,90 @@ import (
 type AWSSecurityGroupRuleSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonSpec `json:",inline"`
 
 	// Foo is an example field of AWSSecurityGroupRule. Edit AWSSecurityGroupRule_types.go to remove/update
 	Provider string `json:"provider,omitempty"`
-	SG       string `json:"sg,omitempty"`
-	ID       string `json:"id,omitempty"`
-	Type     string `json:"type,omitempty"`
+	// SG is the name of the AWSSecurityGroup of the rule. Deprecated: use
+	// SecurityGroupRef.
+	SG string `json:"sg,omitempty"`
+	// SecurityGroupRef references the AWSSecurityGroup of the rule
+	SecurityGroupRef *ResourceReference `json:"securityGroupRef,omitempty"`
+	// ID of the cloud resource, set once it's provisioned. Rules can't be
+	// imported, the ID must not be set on creation.
+	ID string `json:"id,omitempty"`
+
+	// Type of the rule, ingress or egress
+	// +kubebuilder:validation:Enum=ingress;egress
+	Type string `json:"type,omitempty"`
+
+	// FromPort and ToPort are the port range of the rule, or the ICMP type
+	// and code
 	FromPort string `json:"fromport,omitempty"`
 	ToPort   string `json:"toport,omitempty"`
+
+	// Protocol of the rule: tcp, udp, icmp, or -1 for all of them
 	Protocol string `json:"protocol,omitempty"`
-	CIDR     string `json:"cidr,omitempty"`
+
+	// CIDR is an IPv4 CIDR block allowed by the rule, it's added to CIDRs
+	CIDR string `json:"cidr,omitempty"`
+
+	// CIDRs are the IPv4 CIDR blocks allowed by the rule
+	CIDRs []string `json:"cidrs,omitempty"`
+
+	// IPv6CIDRs are the IPv6 CIDR blocks allowed by the rule
+	IPv6CIDRs []string `json:"ipv6CIDRs,omitempty"`
+
+	// SourceSG is the name of the AWSSecurityGroup allowed by the rule. It
+	// can't be combined with CIDRs or Self. Deprecated: use
+	// SourceSecurityGroupRef.
+	SourceSG string `json:"sourceSG,omitempty"`
+	// SourceSecurityGroupRef references the AWSSecurityGroup allowed by the
+	// rule
+	SourceSecurityGroupRef *ResourceReference `json:"sourceSecurityGroupRef,omitempty"`
+
+	// Self allows the security group of the rule itself
+	Self bool `json:"self,omitempty"`
+
+	// Description of the rule
+	Description string `json:"description,omitempty"`
+}
+
+// GetSGName returns the name of the AWSSecurityGroup of the rule
+func (s *AWSSecurityGroupRuleSpec) GetSGName() string {
+	return referenceName(s.SecurityGroupRef, s.SG)
+}
+
+// GetSourceSGName returns the name of the AWSSecurityGroup allowed by the rule
+func (s *AWSSecurityGroupRuleSpec) GetSourceSGName() string {
+	return referenceName(s.SourceSecurityGroupRef, s.SourceSG)
+}
+
+// GetCIDRs returns the IPv4 CIDR blocks allowed by the rule, including CIDR
+func (s *AWSSecurityGroupRuleSpec) GetCIDRs() []string {
+	cidrs := []string{}
+	if s.CIDR != "" {
+		cidrs = append(cidrs, s.CIDR)
+	}
+	for _, cidr := range s.CIDRs {
+		if cidr != s.CIDR {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs
 }
 
 // AWSSecurityGroupRuleStatus defines the observed state of AWSSecurityGroupRule
 type AWSSecurityGroupRuleStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// Lock is the lock on the Terraform state blocking the last reconcile
+	Lock *LockStatus `json:"lock,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -68,6 +134,16 @@ type AWSSecurityGroupRuleList struct {
 	Items           []AWSSecurityGroupRule `json:"items"`
 }
 
+// GetID returns the ID of the provisioned security group rule
+func (in *AWSSecurityGroupRule) GetID() string {
+	return in.Spec.ID
+}
+
+// GetCommonStatus returns the common status of the security group rule
+func (in *AWSSecurityGroupRule) GetCommonStatus() *CommonStatus {
+	return &in.Status.CommonStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&AWSSecurityGroupRule{}, &AWSSecurityGroupRuleList{})
 }
@@ -27,21 +27,48 @@ import (
 type AWSSubnetSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonSpec `json:",inline"`
 
 	// Foo is an example field of AWSSubnet. Edit AWSSubnet_types.go to remove/update
 	Provider string `json:"provider,omitempty"`
-	VPC      string `json:"vpc,omitempty"`
-	ID       string `json:"id,omitempty"`
-	CIDR     string `json:"cidr,omitempty"`
-	Zone     string `json:"zone,omitempty"`
+	// VPC is the name of the AWSVPC of the subnet. Deprecated: use VPCRef.
+	VPC string `json:"vpc,omitempty"`
+	// VPCRef references the AWSVPC of the subnet
+	VPCRef *ResourceReference `json:"vpcRef,omitempty"`
+	// ID of the cloud resource, set once it's provisioned. An existing cloud
+	// resource is imported when its ID is set on creation.
+	ID   string `json:"id,omitempty"`
+	CIDR string `json:"cidr,omitempty"`
+	Zone string `json:"zone,omitempty"`
+}
+
+// AWSSubnetObservation is the observed state of the subnet in the cloud
+type AWSSubnetObservation struct {
+	// ARN of the subnet
+	ARN string `json:"arn,omitempty"`
+
+	// OwnerID is the ID of the AWS account owning the subnet
+	OwnerID string `json:"ownerID,omitempty"`
+
+	// AvailabilityZone and AvailabilityZoneID are the zone of the subnet
+	AvailabilityZone   string `json:"availabilityZone,omitempty"`
+	AvailabilityZoneID string `json:"availabilityZoneID,omitempty"`
 }
 
 // AWSSubnetStatus defines the observed state of AWSSubnet
 type AWSSubnetStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// Lock is the lock on the Terraform state blocking the last reconcile
+	Lock *LockStatus `json:"lock,omitempty"`
+
+	// AtProvider is the observed state of the provisioned subnet
+	AtProvider *AWSSubnetObservation `json:"atProvider,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -65,6 +92,21 @@ type AWSSubnetList struct {
 	Items           []AWSSubnet `json:"items"`
 }
 
+// GetVPCName returns the name of the AWSVPC of the subnet
+func (s *AWSSubnetSpec) GetVPCName() string {
+	return referenceName(s.VPCRef, s.VPC)
+}
+
+// GetID returns the ID of the provisioned subnet
+func (in *AWSSubnet) GetID() string {
+	return in.Spec.ID
+}
+
+// GetCommonStatus returns the common status of the subnet
+func (in *AWSSubnet) GetCommonStatus() *CommonStatus {
+	return &in.Status.CommonStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&AWSSubnet{}, &AWSSubnetList{})
 }
@@ -27,19 +27,46 @@ import (
 type AWSVPCSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonSpec `json:",inline"`
 
 	// Foo is an example field of AWSVPC. Edit AWSVPC_types.go to remove/update
 	Provider string `json:"provider,omitempty"`
-	ID       string `json:"id,omitempty"`
-	CIDR     string `json:"cidr,omitempty"`
+	// ID of the cloud resource, set once it's provisioned. An existing cloud
+	// resource is imported when its ID is set on creation.
+	ID   string `json:"id,omitempty"`
+	CIDR string `json:"cidr,omitempty"`
+}
+
+// AWSVPCObservation is the observed state of the VPC in the cloud
+type AWSVPCObservation struct {
+	// ARN of the VPC
+	ARN string `json:"arn,omitempty"`
+
+	// OwnerID is the ID of the AWS account owning the VPC
+	OwnerID string `json:"ownerID,omitempty"`
+
+	// IDs of the route tables, security group and network ACL created with
+	// the VPC
+	MainRouteTableID       string `json:"mainRouteTableID,omitempty"`
+	DefaultRouteTableID    string `json:"defaultRouteTableID,omitempty"`
+	DefaultSecurityGroupID string `json:"defaultSecurityGroupID,omitempty"`
+	DefaultNetworkACLID    string `json:"defaultNetworkACLID,omitempty"`
 }
 
 // AWSVPCStatus defines the observed state of AWSVPC
 type AWSVPCStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// Lock is the lock on the Terraform state blocking the last reconcile
+	Lock *LockStatus `json:"lock,omitempty"`
+
+	// AtProvider is the observed state of the provisioned VPC
+	AtProvider *AWSVPCObservation `json:"atProvider,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -63,6 +90,16 @@ type AWSVPCList struct {
 	Items           []AWSVPC `json:"items"`
 }
 
+// GetID returns the ID of the provisioned VPC
+func (in *AWSVPC) GetID() string {
+	return in.Spec.ID
+}
+
+// GetCommonStatus returns the common status of the VPC
+func (in *AWSVPC) GetCommonStatus() *CommonStatus {
+	return &in.Status.CommonStatus
+}
+
 func init() {
 	SchemeBuilder.Register(&AWSVPC{}, &AWSVPCList{})
 }
@@ -0,0 +1,269 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DriftPolicy is what the controller does when the cloud resources drift from
+// the spec
+// +kubebuilder:validation:Enum=Ignore;Report;Reconcile
+type DriftPolicy string
+
+const (
+	// DriftPolicyIgnore only records the drifted resources
+	DriftPolicyIgnore DriftPolicy = "Ignore"
+	// DriftPolicyReport records the drifted resources and sets the Drifted condition
+	DriftPolicyReport DriftPolicy = "Report"
+	// DriftPolicyReconcile applies the spec again to restore the desired state
+	DriftPolicyReconcile DriftPolicy = "Reconcile"
+)
+
+// DeletionPolicy is what happens to the cloud resources when the resource is
+// deleted
+// +kubebuilder:validation:Enum=Delete;Orphan
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete destroys the cloud resources
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan keeps the cloud resources, only their Terraform
+	// state is removed
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// DefaultDriftCheckInterval is how often the drift is checked by default
+const DefaultDriftCheckInterval = 60 * time.Second
+
+// CommonSpec holds the spec fields shared by the provisioned kinds
+type CommonSpec struct {
+	// DriftPolicy is one of Ignore, Report or Reconcile. Default: Reconcile
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+	// DriftCheckInterval is how often the cloud resources are checked for
+	// drift. Default: 60s
+	DriftCheckInterval *metav1.Duration `json:"driftCheckInterval,omitempty"`
+	// DeletionPolicy is one of Delete or Orphan. Default: the default deletion
+	// policy of the Provider, Delete if it's not set
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// GetDriftPolicy returns the drift policy, or the default one if it's not set
+func (s *CommonSpec) GetDriftPolicy() DriftPolicy {
+	if s.DriftPolicy == "" {
+		return DriftPolicyReconcile
+	}
+	return s.DriftPolicy
+}
+
+// GetDriftCheckInterval returns the drift check interval, or the default one
+// if it's not set
+func (s *CommonSpec) GetDriftCheckInterval() time.Duration {
+	if s.DriftCheckInterval == nil || s.DriftCheckInterval.Duration <= 0 {
+		return DefaultDriftCheckInterval
+	}
+	return s.DriftCheckInterval.Duration
+}
+
+// GetDeletionPolicy returns the deletion policy, or the default deletion policy
+// of the provider if it's not set
+func (s *CommonSpec) GetDeletionPolicy(provider *Provider) DeletionPolicy {
+	if s.DeletionPolicy != "" {
+		return s.DeletionPolicy
+	}
+	if provider != nil && provider.Spec.DefaultDeletionPolicy != "" {
+		return provider.Spec.DefaultDeletionPolicy
+	}
+	return DeletionPolicyDelete
+}
+
+// ConnectionSecretReference is a reference to the Secret where the connection
+// details of a provisioned resource are written
+type ConnectionSecretReference struct {
+	// Name of the Secret, in the namespace of the resource
+	Name string `json:"name"`
+}
+
+// SecretKeyReference is a reference to a key of a Secret
+type SecretKeyReference struct {
+	// Name of the Secret, in the namespace of the resource
+	Name string `json:"name"`
+
+	// Key of the value in the Secret
+	Key string `json:"key,omitempty"`
+}
+
+// ResourceReference is a reference to another resource of the operator. The
+// resource waits for the referenced resource to be Ready before it's
+// provisioned.
+type ResourceReference struct {
+	// Name of the referenced resource, in the namespace of the resource
+	Name string `json:"name"`
+}
+
+// referenceName returns the name of the referenced resource, or the name set
+// by the legacy field of the reference
+func referenceName(ref *ResourceReference, name string) string {
+	if ref != nil {
+		return ref.Name
+	}
+	return name
+}
+
+// ConfigMapKeyReference is a reference to a key of a ConfigMap
+type ConfigMapKeyReference struct {
+	// Name of the ConfigMap, in the namespace of the resource
+	Name string `json:"name"`
+
+	// Key of the value in the ConfigMap
+	Key string `json:"key"`
+}
+
+// ForceUnlockAnnotation releases the state lock with the given ID
+const ForceUnlockAnnotation = "terraform.tmax.io/force-unlock"
+
+// ApplyImportAnnotation applies the spec to an imported resource when it's
+// "true". The differences of the imported cloud resources from the spec are
+// only reported until then, unless the drift policy is set to Reconcile.
+const ApplyImportAnnotation = "terraform.tmax.io/apply-import"
+
+// CascadeDeleteAnnotation deletes the resources referencing a deleted
+// resource when it's "true", instead of waiting for them to be deleted. The
+// annotation is passed on to the deleted resources, so the whole tree is
+// deleted from its leaves.
+const CascadeDeleteAnnotation = "terraform.tmax.io/cascade-delete"
+
+// LockStatus describes the lock held on the Terraform state of a resource by
+// another operation
+type LockStatus struct {
+	// ID of the lock, to be set in the force-unlock annotation
+	ID string `json:"id"`
+	// Holder is the identity of the operator holding the lock
+	Holder string `json:"holder,omitempty"`
+	// Operation is the Terraform operation holding the lock
+	Operation string `json:"operation,omitempty"`
+	// Created is when the lock was acquired
+	Created metav1.Time `json:"created,omitempty"`
+	// Stale is true when the holder stopped renewing the lock
+	Stale bool `json:"stale,omitempty"`
+}
+
+// DestroyFinalizer makes sure the cloud resources are destroyed before the
+// resource is deleted
+const DestroyFinalizer = "terraform.tmax.io/destroy"
+
+// ProviderFinalizer holds the deletion of a Provider until the resources using
+// it are gone, their cloud resources are destroyed with its credentials. The
+// resources are deleted with the Provider.
+const ProviderFinalizer = "terraform.tmax.io/provider-in-use"
+
+// Types of the conditions
+const (
+	// ConditionReady is true when the cloud resources have been provisioned
+	ConditionReady = "Ready"
+	// ConditionSynced is true when the last reconcile succeeded
+	ConditionSynced = "Synced"
+	// ConditionDrifted is true when the cloud resources differ from the spec
+	ConditionDrifted = "Drifted"
+	// ConditionDeleting is true while the cloud resources are being destroyed
+	ConditionDeleting = "Deleting"
+	// ConditionWaitingForDependency is true while a referenced resource is
+	// not Ready
+	ConditionWaitingForDependency = "WaitingForDependency"
+)
+
+// Condition contains details for one aspect of the current state of a resource.
+// It's the same as metav1.Condition of newer versions of Kubernetes.
+type Condition struct {
+	// Type of the condition: Ready, Synced, Drifted, Deleting or
+	// WaitingForDependency
+	Type string `json:"type"`
+	// Status of the condition, one of True, False, Unknown
+	Status metav1.ConditionStatus `json:"status"`
+	// ObservedGeneration is the generation the condition was set upon
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastTransitionTime is the last time the condition changed its status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+	// Reason is a CamelCase reason for the condition's last transition
+	Reason string `json:"reason"`
+	// Message is a human readable message with details about the transition
+	Message string `json:"message,omitempty"`
+}
+
+// CommonStatus holds the status fields shared by every kind
+type CommonStatus struct {
+	// ObservedGeneration is the latest generation reconciled by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastAppliedTime is the last time the cloud resources were applied
+	LastAppliedTime *metav1.Time `json:"lastAppliedTime,omitempty"`
+	// LastAppliedGeneration is the generation of the last applied spec
+	LastAppliedGeneration int64 `json:"lastAppliedGeneration,omitempty"`
+	// Plan is the result of the last plan
+	Plan *PlanStatus `json:"plan,omitempty"`
+	// FailureReason is a CamelCase reason of the last failure
+	FailureReason string `json:"failureReason,omitempty"`
+	// FailureMessage describes the last failure
+	FailureMessage string `json:"failureMessage,omitempty"`
+	// Conditions of the resource
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// ComponentStatus is the status of a resource created by a composite kind
+type ComponentStatus struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// ID of the provisioned cloud resource
+	ID string `json:"id,omitempty"`
+	// Ready is the status of the Ready condition of the resource
+	Ready metav1.ConditionStatus `json:"ready"`
+	// Message of the Ready condition, when the resource is not Ready
+	Message string `json:"message,omitempty"`
+}
+
+// PlanStatus holds the planned action counts of a Terraform plan
+type PlanStatus struct {
+	Add     int `json:"add"`
+	Change  int `json:"change"`
+	Destroy int `json:"destroy"`
+	// Time of the plan
+	Time metav1.Time `json:"time,omitempty"`
+	// Resources are the resources to change, the ones which drifted from the
+	// desired state
+	Resources []ResourceChange `json:"resources,omitempty"`
+}
+
+// Actions of a ResourceChange
+const (
+	// ActionCreate creates a resource which went missing
+	ActionCreate = "create"
+	// ActionUpdate updates a resource in-place
+	ActionUpdate = "update"
+	// ActionReplace destroys and creates again a resource
+	ActionReplace = "replace"
+	// ActionDelete deletes a resource
+	ActionDelete = "delete"
+)
+
+// ResourceChange is a planned change of a resource
+type ResourceChange struct {
+	// Address of the resource, e.g. aws_vpc.sample
+	Address string `json:"address"`
+	// Action is one of create, update, replace or delete
+	Action string `json:"action"`
+}
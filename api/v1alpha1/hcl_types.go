@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,19 +28,83 @@ import (
 type HCLSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonSpec `json:",inline"`
+
+	// Provider is the name of the Provider whose cloud and credentials are
+	// used to apply the code. The code is applied by the operator with these
+	// credentials, creating an HCL grants the same access to the cloud as the
+	// Provider. The code can't configure providers nor read files, e.g. by
+	// the file functions.
+	Provider string `json:"provider,omitempty"`
+
+	// Path is the file name of the content, shown in the errors.
+	// Default: main.tf
+	Path string `json:"path,omitempty"`
+
+	// Content is the Terraform code. It must not configure the provider of
+	// the cloud nor declare its variables, e.g. access_key, secret_key and
+	// region for AWS.
+	Content string `json:"content,omitempty"`
+
+	// Enabled pauses the HCL when it's false: the code is neither applied nor
+	// checked for drift, but it's still destroyed when the HCL is deleted.
+	// Default: true
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Vars are the values of the variables declared in the code, e.g.
+	// strings, numbers, lists or maps. The values are converted to the types
+	// of the variables.
+	Vars map[string]apiextensionsv1.JSON `json:"vars,omitempty"`
+
+	// VarsFrom are the values of variables read from ConfigMaps or Secrets.
+	// Vars take precedence over them.
+	VarsFrom []HCLVarSource `json:"varsFrom,omitempty"`
+
+	// WriteConnectionSecretToRef is the Secret where all the outputs of the
+	// code are written, including the sensitive ones
+	// +optional
+	WriteConnectionSecretToRef *ConnectionSecretReference `json:"writeConnectionSecretToRef,omitempty"`
+}
+
+// HCLVarSource is the value of a variable read from a ConfigMap or a Secret.
+// Exactly one of ConfigMapKeyRef and SecretKeyRef is set, the key of the
+// Secret is the name of the variable by default.
+type HCLVarSource struct {
+	// Name of the variable
+	Name string `json:"name"`
 
-	// Foo is an example field of HCL. Edit HCL_types.go to remove/update
-	Path    string `json:"path,omitempty"`
-	Cotent  string `json:"content,omitempty"`
-	Enabled bool   `json:"enabled,omitempty"`
+	ConfigMapKeyRef *ConfigMapKeyReference `json:"configMapKeyRef,omitempty"`
+	SecretKeyRef    *SecretKeyReference    `json:"secretKeyRef,omitempty"`
+}
+
+// GetPath returns the file name of the content
+func (s *HCLSpec) GetPath() string {
+	if s.Path == "" {
+		return "main.tf"
+	}
+	return s.Path
+}
+
+// GetEnabled returns false if the HCL is paused
+func (s *HCLSpec) GetEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
 }
 
 // HCLStatus defines the observed state of HCL
 type HCLStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// Outputs are the outputs of the code, except the sensitive ones. The
+	// values which are not strings, numbers or bools are JSON-encoded.
+	Outputs map[string]string `json:"outputs,omitempty"`
+
+	// Lock is the lock held on the state by another operation, if any
+	Lock *LockStatus `json:"lock,omitempty"`
 }
 
 // +kubebuilder:object:root=true
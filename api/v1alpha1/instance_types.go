@@ -28,23 +28,69 @@ type InstanceSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Foo is an example field of Instance. Edit Instance_types.go to remove/update
+	// CommonSpec is passed on to the AWSInstances of the instance
+	CommonSpec `json:",inline"`
+
+	// Size is the number of replicas
+	// +kubebuilder:validation:Minimum=0
 	Size     int32  `json:"size,omitempty"`
 	Provider string `json:"provider,omitempty"`
-	Network  string `json:"network,omitempty"`
-	Image    string `json:"image,omitempty"`
-	Type     string `json:"type,omitempty"`
-	Key      string `json:"key,omitempty"`
+
+	// Network is the name of the Network of the replicas. They're spread
+	// across its subnets, in its security group.
+	Network string `json:"network,omitempty"`
+
+	// Image, Type and Key of the replicas. The replicas are replaced when
+	// they change.
+	Image string `json:"image,omitempty"`
+	Type  string `json:"type,omitempty"`
+	Key   string `json:"key,omitempty"`
+
+	// MaxUnavailable is the maximum number of replicas which can be
+	// unavailable while they're replaced. Default: 1
+	// +kubebuilder:validation:Minimum=1
+	MaxUnavailable *int32 `json:"maxUnavailable,omitempty"`
+}
+
+// GetMaxUnavailable returns the maximum number of unavailable replicas while
+// they're replaced
+func (s *InstanceSpec) GetMaxUnavailable() int32 {
+	if s.MaxUnavailable == nil || *s.MaxUnavailable < 1 {
+		return 1
+	}
+	return *s.MaxUnavailable
 }
 
 // InstanceStatus defines the observed state of Instance
 type InstanceStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
+	// Nodes are the names of the AWSInstances of the replicas
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// Replicas is the number of replicas, including the ones being replaced
+	Replicas int32 `json:"replicas,omitempty"`
+	// ReadyReplicas is the number of Ready replicas
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// UpdatedReplicas is the number of replicas with the current image, type
+	// and key
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
 }
 
+// Labels of the AWSInstances created by an instance
+const (
+	// InstanceLabel is set to the name of the instance
+	InstanceLabel = "terraform.tmax.io/instance"
+	// TemplateHashLabel is set to the hash of the image, type and key of the
+	// replica
+	TemplateHashLabel = "terraform.tmax.io/template-hash"
+	// ReplicaLabel is set to the index of the replica
+	ReplicaLabel = "terraform.tmax.io/replica"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
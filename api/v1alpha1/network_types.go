@@ -28,21 +28,100 @@ type NetworkSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
+	// CommonSpec is passed on to the resources of the network
+	CommonSpec `json:",inline"`
+
 	// Foo is an example field of Network. Edit Network_types.go to remove/update
-	Provider   string `json:"provider,omitempty"`
-	VPCCIDR    string `json:"vpccidr,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	VPCCIDR  string `json:"vpccidr,omitempty"`
+
+	// SubnetCIDR is the CIDR block of a single subnet. Deprecated: use
+	// Subnets.
 	SubnetCIDR string `json:"subnetcidr,omitempty"`
-	RouteCIDR  string `json:"routecidr,omitempty"`
+
+	// RouteCIDR is the destination routed to the internet gateway. Default:
+	// 0.0.0.0/0
+	RouteCIDR string `json:"routecidr,omitempty"`
+
+	// Subnets of the network, each one has its own route table
+	Subnets []NetworkSubnet `json:"subnets,omitempty"`
+
+	// SSHCIDRs are the CIDR blocks allowed to connect to the instances of
+	// the network by SSH. Default: 0.0.0.0/0
+	SSHCIDRs []string `json:"sshCIDRs,omitempty"`
+}
+
+// NetworkSubnet is a subnet of a network
+type NetworkSubnet struct {
+	// CIDR block of the subnet, in the CIDR block of the VPC
+	CIDR string `json:"cidr"`
+
+	// Zone is the letter of the availability zone of the subnet in the
+	// region of the provider. Default: a, b, c... in the order of the
+	// subnets
+	Zone string `json:"zone,omitempty"`
+}
+
+// DefaultRouteCIDR is the destination routed to the internet gateway by
+// default
+const DefaultRouteCIDR = "0.0.0.0/0"
+
+// GetSubnets returns the subnets of the network, with their zones
+func (s *NetworkSpec) GetSubnets() []NetworkSubnet {
+	subnets := s.Subnets
+	if len(subnets) == 0 && s.SubnetCIDR != "" {
+		subnets = []NetworkSubnet{{CIDR: s.SubnetCIDR}}
+	}
+
+	result := []NetworkSubnet{}
+	for i, subnet := range subnets {
+		if subnet.Zone == "" {
+			subnet.Zone = string(rune('a' + i))
+		}
+		result = append(result, subnet)
+	}
+	return result
+}
+
+// GetRouteCIDR returns the destination routed to the internet gateway
+func (s *NetworkSpec) GetRouteCIDR() string {
+	if s.RouteCIDR == "" {
+		return DefaultRouteCIDR
+	}
+	return s.RouteCIDR
+}
+
+// GetSSHCIDRs returns the CIDR blocks allowed to connect by SSH
+func (s *NetworkSpec) GetSSHCIDRs() []string {
+	if len(s.SSHCIDRs) == 0 {
+		return []string{"0.0.0.0/0"}
+	}
+	return s.SSHCIDRs
 }
 
 // NetworkStatus defines the observed state of Network
 type NetworkStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// VPC, Subnets and SecurityGroup are the names of the resources of the
+	// network, to be referenced by other resources
+	VPC           string   `json:"vpc,omitempty"`
+	Subnets       []string `json:"subnets,omitempty"`
+	SecurityGroup string   `json:"securityGroup,omitempty"`
+
+	// Components are the resources created by the network
+	Components []ComponentStatus `json:"components,omitempty"`
 }
 
+// NetworkLabel is set on the resources created by a network, to the name of
+// the network
+const NetworkLabel = "terraform.tmax.io/network"
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 
@@ -29,10 +29,20 @@ type ProviderSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
 
 	// Foo is an example field of Provider. Edit Provider_types.go to remove/update
-	Cloud  string    `json:"cloud,omitempty"`
-	Region string    `json:"region,omitempty"`
-	AWS    AWSSpec   `json:"aws,omitempty"`
-	Azure  AzureSpec `json:"azure,omitempty"`
+	Cloud  string `json:"cloud,omitempty"`
+	Region string `json:"region,omitempty"`
+
+	// DefaultDeletionPolicy is the deletion policy of the resources of the
+	// Provider which don't set one. Default: Delete
+	DefaultDeletionPolicy DeletionPolicy `json:"defaultDeletionPolicy,omitempty"`
+
+	// CredentialsSecretRef references the Secret holding the credentials of the cloud
+	CredentialsSecretRef *CredentialsSecretRef `json:"credentialsSecretRef,omitempty"`
+
+	// Deprecated: inline credentials are moved into a Secret, use CredentialsSecretRef
+	AWS AWSSpec `json:"aws,omitempty"`
+	// Deprecated: inline credentials are moved into a Secret, use CredentialsSecretRef
+	Azure AzureSpec `json:"azure,omitempty"`
 	/*
 		AccessKey      string `json:"accesskey,omitempty"`
 		SecretKey      string `json:"secretkey,omitempty"`
@@ -55,10 +65,40 @@ type AzureSpec struct {
 	TenantID       string `json:"tenantid,omitempty"`
 }
 
+// CredentialsSecretRef references a Secret in the namespace of the Provider. The
+// key mappings of the cloud select the Secret keys holding each credential.
+type CredentialsSecretRef struct {
+	Name  string               `json:"name"`
+	AWS   *AWSCredentialKeys   `json:"aws,omitempty"`
+	Azure *AzureCredentialKeys `json:"azure,omitempty"`
+}
+
+// AWSCredentialKeys are the Secret keys of the AWS credentials
+type AWSCredentialKeys struct {
+	// Default: accessKey
+	AccessKey string `json:"accessKey,omitempty"`
+	// Default: secretKey
+	SecretKey string `json:"secretKey,omitempty"`
+}
+
+// AzureCredentialKeys are the Secret keys of the Azure credentials
+type AzureCredentialKeys struct {
+	// Default: subscriptionID
+	SubscriptionID string `json:"subscriptionID,omitempty"`
+	// Default: clientID
+	ClientID string `json:"clientID,omitempty"`
+	// Default: clientSecret
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// Default: tenantID
+	TenantID string `json:"tenantID,omitempty"`
+}
+
 // ProviderStatus defines the observed state of Provider
 type ProviderStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
 }
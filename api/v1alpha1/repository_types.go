@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,20 +29,98 @@ type RepositorySpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Foo is an example field of Repository. Edit Repository_types.go to remove/update
-	Type   string `json:"type,omitempty"`
-	URL    string `json:"url,omitempty"`
+	URL string `json:"url,omitempty"`
+
+	// Ref is the revision of the repository whose code is applied, one of:
+	// - a branch, whose head is applied as it moves
+	// - a tag
+	// - a version range on the tags, e.g. "~> 1.2" or ">= 1.0, < 2.0", the
+	//   highest matching version is applied
+	// - the full hash of a commit
+	// Default: Branch, or the default branch of the repository
+	Ref string `json:"ref,omitempty"`
+
+	// Deprecated: use Ref
 	Branch string `json:"branch,omitempty"`
-	ID     string `json:"id,omitempty"`
-	PW     string `json:"pw,omitempty"`
+
+	// SecretRef references the Secret holding the credentials of the
+	// repository, with the keys:
+	// - username and password, or token, for HTTPS
+	// - identity, the private key, its passphrase if any and known_hosts, the
+	//   public keys of the server, for SSH
+	// - ca.crt, the CA bundle of an HTTPS server signed by a custom CA
+	SecretRef *RepositorySecretReference `json:"secretRef,omitempty"`
+
+	// Deprecated: the credentials are read from the Secret of SecretRef
+	Type string `json:"type,omitempty"`
+	// Deprecated: inline credentials are moved into a Secret, use SecretRef
+	ID string `json:"id,omitempty"`
+	// Deprecated: inline credentials are moved into a Secret, use SecretRef
+	PW string `json:"pw,omitempty"`
+
+	// Provider is the name of the Provider whose cloud and credentials are
+	// used to apply the code. The code is applied by the operator with these
+	// credentials, creating a Repository grants the same access to the cloud
+	// as the Provider. The code can't configure providers nor read files,
+	// e.g. by the file functions.
+	Provider string `json:"provider,omitempty"`
+
+	// Path is the directory of the repository holding the root module of the
+	// code. The local modules it calls can be anywhere in the repository.
+	// Default: the top directory
+	Path string `json:"path,omitempty"`
+
+	// Vars are the values of the variables declared in the root module, e.g.
+	// strings, numbers, lists or maps. The values are converted to the types
+	// of the variables.
+	Vars map[string]apiextensionsv1.JSON `json:"vars,omitempty"`
+
+	// DeletionPolicy is one of Delete or Orphan. Default: the default deletion
+	// policy of the Provider, Delete if it's not set
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// RepositorySecretReference references the Secret of the Git credentials, in
+// the namespace of the Repository
+type RepositorySecretReference struct {
+	Name string `json:"name"`
+}
+
+// GetRef returns the ref, or the branch if it's not set
+func (s *RepositorySpec) GetRef() string {
+	if s.Ref == "" {
+		return s.Branch
+	}
+	return s.Ref
+}
+
+// GetDeletionPolicy returns the deletion policy, or the default deletion policy
+// of the provider if it's not set
+func (s *RepositorySpec) GetDeletionPolicy(provider *Provider) DeletionPolicy {
+	common := CommonSpec{DeletionPolicy: s.DeletionPolicy}
+	return common.GetDeletionPolicy(provider)
 }
 
 // RepositoryStatus defines the observed state of Repository
 type RepositoryStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
+
+	// Commit is the commit of the ref at the last sync
+	Commit string `json:"commit,omitempty"`
+	// Tag is the tag of the commit, when the ref is a tag or a version range
+	Tag string `json:"tag,omitempty"`
+	// LastAppliedCommit is the commit of the last applied code
+	LastAppliedCommit string `json:"lastAppliedCommit,omitempty"`
+	// LastSyncTime is the last time the repository was fetched
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// Lock is the lock held on the state by another operation, if any
+	Lock *LockStatus `json:"lock,omitempty"`
 }
 
 // +kubebuilder:object:root=true
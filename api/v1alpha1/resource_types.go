@@ -83,6 +83,8 @@ type AWS_SG_RULE struct {
 type ResourceStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
+
 	Nodes []string `json:"nodes,omitempty"`
 	Phase string   `json:"phase,omitempty"`
 }
@@ -91,6 +93,9 @@ type ResourceStatus struct {
 // +kubebuilder:subresource:status
 
 // Resource is the Schema for the resources API
+//
+// Deprecated: Resources are not reconciled, use the kinds of each cloud
+// resource, e.g. AWSVPC
 type Resource struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
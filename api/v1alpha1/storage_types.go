@@ -36,6 +36,7 @@ type StorageSpec struct {
 type StorageStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	CommonStatus `json:",inline"`
 }
 
 // +kubebuilder:object:root=true
@@ -18,17 +18,18 @@ package controllers
 
 import (
 	"context"
-	"fmt"
-	"time"
+	"strings"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
 	"github.com/tmax-cloud/terraform-operator/util"
@@ -37,8 +38,9 @@ import (
 // AWSGatewayReconciler reconciles a AWSGateway object
 type AWSGatewayReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=awsgateways,verbs=get;list;watch;create;update;patch;delete
@@ -48,7 +50,7 @@ type AWSGatewayReconciler struct {
 func (r *AWSGatewayReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("awsgateway", req.NamespacedName)
-	var id string
+	var obs *util.Observation
 
 	// Fetch the AWS-Gateway instance
 	resource := &terraformv1alpha1.AWSGateway{}
@@ -59,43 +61,6 @@ func (r *AWSGatewayReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
 			log.Info("`Resource` resource not found. Ignoring since object must be deleted")
-
-			cm := &corev1.ConfigMap{}
-			err = r.Get(ctx, req.NamespacedName, cm)
-			if err != nil {
-				if errors.IsNotFound(err) {
-					// Request object not found, could have been deleted after reconcile request.
-					// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
-					// Return and don't requeue
-					log.Info("ConfigMap resource not found. Ignoring since object must be deleted")
-					return ctrl.Result{}, nil
-				}
-				// Error reading the object - requeue the request.
-				log.Error(err, "Failed to get ConfigMap")
-				return ctrl.Result{}, err
-			}
-
-			// Recover "Resource" Data using ConfigMap
-			input := util.ConfigmapToVars(cm)
-
-			// Search the Resource ID
-			input = r.SearchResourceID(input)
-
-			// Destroy the Provisioned Resources for Deleted Object (Resource)
-			//err = util.ExecuteTerraform_CLI(util.HCL_DIR, isDestroy)
-			destroy := true
-			id, err = util.ExecuteTerraform(input, destroy)
-			if err != nil {
-				log.Error(err, "Terraform Destroy Error")
-				return ctrl.Result{}, err
-			}
-
-			err = r.Delete(ctx, cm)
-			if err != nil {
-				log.Error(err, "Failed to delete new Confgimap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-				return ctrl.Result{}, err
-			}
-
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -127,9 +92,10 @@ func (r *AWSGatewayReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 
 	input.Name = resource.Name
 	input.Namespace = resource.Namespace
+	input.UID = string(resource.UID)
 	input.GatewayName = resource.Name
 	input.Type = resource.Kind
-	input.VPCName = resource.Spec.VPC
+	input.VPCName = resource.Spec.GetVPCName()
 
 	// Fetch the "Provider" instance related to "Resource" (Resource -> Provider)
 	provider := &terraformv1alpha1.Provider{}
@@ -137,33 +103,14 @@ func (r *AWSGatewayReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	if err != nil {
 		// Error reading the object - requeue the request.
 		log.Error(err, "Failed to get Provider")
+		setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonProviderNotFound, err)
 		return ctrl.Result{}, err
 	}
 
-	input.ProviderName = provider.Name
-	input.Cloud = provider.Spec.Cloud
-	input.Region = provider.Spec.Region
-
-	// AWS
-	input.AccessKey = provider.Spec.AWS.AccessKey
-	input.SecretKey = provider.Spec.AWS.SecretKey
-	// Azure
-	input.SubscriptionID = provider.Spec.Azure.SubscriptionID
-	input.ClientID = provider.Spec.Azure.ClientID
-	input.ClientSecret = provider.Spec.Azure.ClientSecret
-	input.TenantID = provider.Spec.Azure.TenantID
-
-	fmt.Println("ProviderName:" + input.ProviderName)
-	fmt.Println("Cloud:" + input.Cloud)
-	// AWS
-	fmt.Println("AccessKey:" + input.AccessKey)
-	fmt.Println("SecretKey:" + input.SecretKey)
-	fmt.Println("Region:" + input.Region)
-	// Azure
-	fmt.Println("AccessKey:" + input.SubscriptionID)
-	fmt.Println("ClientID:" + input.ClientID)
-	fmt.Println("ClietnSecret:" + input.ClientSecret)
-	fmt.Println("TenantID:" + input.TenantID)
+	// The credentials are read from the Secret of the provider when Terraform is executed
+	input = util.ProviderVars(input, provider)
+
+	log.V(1).Info("Provider", "provider", input.ProviderName, "cloud", input.Cloud, "region", input.Region)
 
 	// Set Provider as the owner and controller in Resource CR
 	if err = ctrl.SetControllerReference(provider, resource, r.Scheme); err != nil {
@@ -171,52 +118,176 @@ func (r *AWSGatewayReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{}, err
 	}
 
-	// Search the Resource ID
-	input = r.SearchResourceID(input)
+	// Resolve the IDs of the referenced resources
+	refErr := resolveReferences(ctx, r.Client, resource.Namespace,
+		reference{field: "vpcRef", name: input.VPCName, target: &terraformv1alpha1.AWSVPC{}, id: &input.VPCID},
+	)
+	if refErr != nil && !isDependencyError(refErr) {
+		log.Error(refErr, "Failed to get the referenced resources")
+		return ctrl.Result{}, refErr
+	}
 
-	// Check if the configmap already exists, if not create a new one
-	cmList := &corev1.ConfigMap{}
-	err = r.Get(ctx, types.NamespacedName{Name: resource.Name, Namespace: resource.Namespace}, cmList)
-	if err != nil && errors.IsNotFound(err) {
-		// Define a new ConfigMap
+	// Release the state lock requested by the force-unlock annotation, a
+	// stale lock would block the destroy too
+	util.ForceUnlockAnnotated(r.Client, input, resource, log)
 
-		cm := util.ConfigmapForResource(input)
-		log.Info("Creating a new Configmap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-		err = r.Create(ctx, cm)
+	// Destroy the provisioned resources before the resource is deleted
+	if !resource.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(resource, terraformv1alpha1.DestroyFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		// Hold the destroy until the resources referencing this one are
+		// deleted, they're watched to reconcile it again
+		dependents, err := holdDeletion(ctx, r.Client, "AWSGateway", resource)
 		if err != nil {
-			log.Error(err, "Failed to create new Confgimap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
+			log.Error(err, "Failed to get the referencing resources")
 			return ctrl.Result{}, err
 		}
-		// Configmap created successfully - return and requeue
-		return ctrl.Result{Requeue: true}, nil
-	} else if err != nil {
-		log.Error(err, "Failed to get Configmap")
-		return ctrl.Result{}, err
+		if len(dependents) != 0 {
+			log.Info("Waiting for the referencing resources to be deleted", "dependents", dependents)
+			setDeletionBlocked(&resource.Status.CommonStatus, resource.Generation, dependents)
+			return ctrl.Result{}, nil
+		}
+
+		// Show the resource as deleting while Terraform is running
+		setDeleting(&resource.Status.CommonStatus, resource.Generation)
+		if err = helper.Patch(ctx, resource); err != nil {
+			log.Error(err, "resource patch error")
+			return ctrl.Result{}, err
+		}
+		helper, _ = patch.NewHelper(resource, r.Client)
+
+		if resource.Spec.GetDeletionPolicy(provider) == terraformv1alpha1.DeletionPolicyOrphan {
+			// Keep the remote resource, only its state is removed
+			ids, err := util.OrphanTerraform(r.Client, input)
+			if err != nil {
+				log.Error(err, "Terraform Orphan Error")
+				resource.Status.Phase = "error"
+				resource.Status.Lock = util.LockStatus(err)
+				setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonOrphanFailed, err)
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Eventf(resource, corev1.EventTypeNormal, ReasonOrphaned, "Kept the cloud resources: %s", strings.Join(ids, ", "))
+		} else {
+			_, err = util.ExecuteTerraform(r.Client, input, true)
+			if err != nil {
+				log.Error(err, "Terraform Destroy Error")
+				resource.Status.Phase = "error"
+				resource.Status.Lock = util.LockStatus(err)
+				setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonDestroyFailed, err)
+				return ctrl.Result{}, err
+			}
+		}
+
+		controllerutil.RemoveFinalizer(resource, terraformv1alpha1.DestroyFinalizer)
+		return ctrl.Result{}, nil
 	}
 
-	// Provision the Resource Resource by Terraform. It'll skip
-	// when `Phase` is `provisioned`.
-	if resource.Status.Phase == "" {
-		id, err = util.ExecuteTerraform(input, false)
+	// Add the finalizer before provisioning, so the resources are never left behind
+	if !controllerutil.ContainsFinalizer(resource, terraformv1alpha1.DestroyFinalizer) {
+		if err = deleteLegacySnapshot(ctx, r.Client, input); err != nil {
+			log.Error(err, "Failed to delete the legacy Configmap")
+			return ctrl.Result{}, err
+		}
+
+		controllerutil.AddFinalizer(resource, terraformv1alpha1.DestroyFinalizer)
+		// Finalizer added - return and requeue
+		return ctrl.Result{Requeue: true}, nil
+	}
 
+	// Wait for the referenced resources, the resource is reconciled again
+	// once they change
+	if refErr != nil {
+		log.Info("Waiting for the referenced resources", "reason", refErr.Error())
+		setWaiting(&resource.Status.CommonStatus, resource.Generation, refErr)
+		return ctrl.Result{}, nil
+	}
+	setDependenciesReady(&resource.Status.CommonStatus, resource.Generation)
+
+	// Provision the Resource Resource by Terraform. Once provisioned, it's
+	// applied again when the spec changed (new generation) or when the plan
+	// shows changes of the remote resource.
+	// The drift of the remote resource is checked by a plan every interval.
+	interval := resource.Spec.GetDriftCheckInterval()
+	next := nextDriftCheck(&resource.Status.CommonStatus, interval)
+
+	// Adopt the existing remote resource of a preset ID instead of creating
+	// a new one, then plan to report its differences from the spec. They're
+	// only applied once acknowledged, see driftPolicy.
+	if resource.Spec.ID != "" && resource.Status.LastAppliedGeneration == 0 {
+		err = util.ImportTerraform(r.Client, input, resource.Spec.ID)
+		resource.Status.Lock = util.LockStatus(err)
 		if err != nil {
+			log.Error(err, "Terraform Import Error")
+			if resource.Status.Lock == nil {
+				resource.Status.Phase = "error"
+			}
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonImportFailed, err)
+			return ctrl.Result{}, err
+		}
+		resource.Status.Phase = "imported"
+		setImported(&resource.Status.CommonStatus, resource.Generation)
+		next = 0
+	}
+
+	apply := resource.Status.Phase == "" || resource.Generation != resource.Status.LastAppliedGeneration
+	if !apply && next == 0 {
+		next = interval
+
+		plan, err := util.PlanTerraform(r.Client, input)
+		resource.Status.Lock = util.LockStatus(err)
+		if resource.Status.Lock != nil {
+			// The state is locked by another operation, retry on the next reconcile
+			log.Info("Terraform state is locked", "LockID", resource.Status.Lock.ID, "Stale", resource.Status.Lock.Stale)
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonPlanFailed, err)
+		} else if err != nil {
 			resource.Status.Phase = "error"
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonPlanFailed, err)
 		} else {
-			resource.Status.Phase = "provisioned"
-			resource.Spec.ID = id
+			log.Info("plan", "add", plan.Add, "change", plan.Change, "destroy", plan.Destroy)
+			resource.Status.Phase = util.PlanPhase(plan)
+			apply = setPlanned(&resource.Status.CommonStatus, resource.Generation, driftPolicy(&resource.Status.CommonStatus, &resource.Spec.CommonSpec, resource), plan)
+
+			// Observe the resources imported, or provisioned before they were observed
+			if resource.Status.AtProvider == nil {
+				if obs, err := util.ObserveTerraform(r.Client, input); err != nil {
+					log.Error(err, "Failed to observe the resource")
+				} else {
+					resource.Status.AtProvider = gatewayObservation(obs)
+				}
+			}
 		}
-	} else {
-		status, err := util.PlanTerraform(input)
-		log.Info("status:" + status)
-		if err != nil {
+	}
+
+	if apply {
+		next = interval
+
+		obs, err = util.ExecuteTerraform(r.Client, input, false)
+		resource.Status.Lock = util.LockStatus(err)
+
+		if resource.Status.Lock != nil {
+			// The state is locked by another operation, retry on the next reconcile
+			log.Info("Terraform state is locked", "LockID", resource.Status.Lock.ID, "Stale", resource.Status.Lock.Stale)
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonApplyFailed, err)
+		} else if err != nil {
 			resource.Status.Phase = "error"
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonApplyFailed, err)
 		} else {
-			resource.Status.Phase = status
+			generation := resource.Generation
+			if resource.Spec.ID != obs.ID {
+				// Recording the ID bumps the generation, not the applied spec
+				resource.Spec.ID = obs.ID
+				generation++
+			}
+			resource.Status.Phase = "provisioned"
+			resource.Status.AtProvider = gatewayObservation(obs)
+			setApplied(&resource.Status.CommonStatus, generation)
 		}
 	}
 	/*
 		if resource.Status.Phase != "provisioned" {
-			id, err = util.ExecuteTerraform(input, false)
+			id, err = util.ExecuteTerraform(r.Client, input, false)
 
 			if err != nil {
 				resource.Status.Phase = "error"
@@ -227,24 +298,25 @@ func (r *AWSGatewayReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		}
 	*/
 	//return ctrl.Result{}, nil
-	return ctrl.Result{RequeueAfter: time.Second * 60}, nil // Reconcile loop rescheduled after 60 seconds
+	return ctrl.Result{RequeueAfter: next}, nil // Reconcile loop rescheduled for the next drift check
 }
 
-// SearchResourceID returns TerraVars struct with resource id
-func (r *AWSGatewayReconciler) SearchResourceID(input util.TerraVars) util.TerraVars {
-	output := input
+func (r *AWSGatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	blder := ctrl.NewControllerManagedBy(mgr).
+		For(&terraformv1alpha1.AWSGateway{})
 
-	if input.VPCName != "" && input.VPCID == "" {
-		vpc := &terraformv1alpha1.AWSVPC{}
-		r.Get(context.TODO(), types.NamespacedName{Name: input.VPCName, Namespace: input.Namespace}, vpc)
-		output.VPCID = vpc.Spec.ID
+	// Reconcile the resource when the resources it references change
+	if err := watchReferences(mgr, blder, "AWSGateway"); err != nil {
+		return err
 	}
-
-	return output
+	// Reconcile the resource when the resources referencing it change
+	watchDependents(blder, "AWSGateway")
+	return blder.Complete(r)
 }
 
-func (r *AWSGatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&terraformv1alpha1.AWSGateway{}).
-		Complete(r)
+// gatewayObservation returns the observed state of the provisioned internet gateway
+func gatewayObservation(obs *util.Observation) *terraformv1alpha1.AWSGatewayObservation {
+	return &terraformv1alpha1.AWSGatewayObservation{
+		OwnerID: obs.Attribute("owner_id"),
+	}
 }
@@ -19,16 +19,21 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
 	"github.com/tmax-cloud/terraform-operator/util"
@@ -37,18 +42,20 @@ import (
 // AWSInstanceReconciler reconciles a AWSInstance object
 type AWSInstanceReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=awsinstances,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=awsinstances/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=awsinstances/finalizers,verbs=update
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
 
 func (r *AWSInstanceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("awsinstance", req.NamespacedName)
-	var id string
+	var obs *util.Observation
 
 	// Fetch the AWS-Instance instance
 	resource := &terraformv1alpha1.AWSInstance{}
@@ -59,43 +66,6 @@ func (r *AWSInstanceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
 			log.Info("`Resource` resource not found. Ignoring since object must be deleted")
-
-			cm := &corev1.ConfigMap{}
-			err = r.Get(ctx, req.NamespacedName, cm)
-			if err != nil {
-				if errors.IsNotFound(err) {
-					// Request object not found, could have been deleted after reconcile request.
-					// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
-					// Return and don't requeue
-					log.Info("ConfigMap resource not found. Ignoring since object must be deleted")
-					return ctrl.Result{}, nil
-				}
-				// Error reading the object - requeue the request.
-				log.Error(err, "Failed to get ConfigMap")
-				return ctrl.Result{}, err
-			}
-
-			// Recover "Resource" Data using ConfigMap
-			input := util.ConfigmapToVars(cm)
-
-			// Search the Resource ID
-			input = r.SearchResourceID(input)
-
-			// Destroy the Provisioned Resources for Deleted Object (Resource)
-			//err = util.ExecuteTerraform_CLI(util.HCL_DIR, isDestroy)
-			destroy := true
-			id, err = util.ExecuteTerraform(input, destroy)
-			if err != nil {
-				log.Error(err, "Terraform Destroy Error")
-				return ctrl.Result{}, err
-			}
-
-			err = r.Delete(ctx, cm)
-			if err != nil {
-				log.Error(err, "Failed to delete new Confgimap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-				return ctrl.Result{}, err
-			}
-
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -127,13 +97,21 @@ func (r *AWSInstanceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 
 	input.Name = resource.Name
 	input.Namespace = resource.Namespace
+	input.UID = string(resource.UID)
 	input.Type = resource.Kind
 	input.InstanceName = resource.Name
 	input.InstanceType = resource.Spec.Type
 	input.ImageID = resource.Spec.Image
 	input.KeyName = resource.Spec.Key
-	input.SGName = resource.Spec.SG
-	input.SubnetName = resource.Spec.Subnet
+	input.SGNames = resource.Spec.GetSGs()
+	input.SubnetName = resource.Spec.GetSubnetName()
+	input.InstanceCount = int(resource.Spec.GetReplicas())
+	input.RootVolume = resource.Spec.RootVolume
+	input.Volumes = resource.Spec.Volumes
+	input.InstanceTags = resource.Spec.Tags
+	input.IAMInstanceProfile = resource.Spec.IAMInstanceProfile
+	input.AssociatePublicIP = resource.Spec.GetAssociatePublicIP()
+	input.PrivateIP = resource.Spec.PrivateIP
 
 	// Fetch the "Provider" instance related to "Resource" (Resource -> Provider)
 	provider := &terraformv1alpha1.Provider{}
@@ -141,33 +119,14 @@ func (r *AWSInstanceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	if err != nil {
 		// Error reading the object - requeue the request.
 		log.Error(err, "Failed to get Provider")
+		setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonProviderNotFound, err)
 		return ctrl.Result{}, err
 	}
 
-	input.ProviderName = provider.Name
-	input.Cloud = provider.Spec.Cloud
-	input.Region = provider.Spec.Region
-
-	// AWS
-	input.AccessKey = provider.Spec.AWS.AccessKey
-	input.SecretKey = provider.Spec.AWS.SecretKey
-	// Azure
-	input.SubscriptionID = provider.Spec.Azure.SubscriptionID
-	input.ClientID = provider.Spec.Azure.ClientID
-	input.ClientSecret = provider.Spec.Azure.ClientSecret
-	input.TenantID = provider.Spec.Azure.TenantID
-
-	fmt.Println("ProviderName:" + input.ProviderName)
-	fmt.Println("Cloud:" + input.Cloud)
-	// AWS
-	fmt.Println("AccessKey:" + input.AccessKey)
-	fmt.Println("SecretKey:" + input.SecretKey)
-	fmt.Println("Region:" + input.Region)
-	// Azure
-	fmt.Println("AccessKey:" + input.SubscriptionID)
-	fmt.Println("ClientID:" + input.ClientID)
-	fmt.Println("ClietnSecret:" + input.ClientSecret)
-	fmt.Println("TenantID:" + input.TenantID)
+	// The credentials are read from the Secret of the provider when Terraform is executed
+	input = util.ProviderVars(input, provider)
+
+	log.V(1).Info("Provider", "provider", input.ProviderName, "cloud", input.Cloud, "region", input.Region)
 
 	// Set Provider as the owner and controller in Resource CR
 	if err = ctrl.SetControllerReference(provider, resource, r.Scheme); err != nil {
@@ -175,52 +134,182 @@ func (r *AWSInstanceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{}, err
 	}
 
-	// Search the Resource ID
-	input = r.SearchResourceID(input)
+	// Resolve the IDs of the referenced resources
+	input.SGIDs = make([]string, len(input.SGNames))
+	refs := []reference{
+		{field: "subnetRef", name: input.SubnetName, target: &terraformv1alpha1.AWSSubnet{}, id: &input.SubnetID},
+	}
+	for i, name := range input.SGNames {
+		refs = append(refs, reference{field: "securityGroupRefs", name: name, target: &terraformv1alpha1.AWSSecurityGroup{}, id: &input.SGIDs[i]})
+	}
+	refErr := resolveReferences(ctx, r.Client, resource.Namespace, refs...)
+	if refErr != nil && !isDependencyError(refErr) {
+		log.Error(refErr, "Failed to get the referenced resources")
+		return ctrl.Result{}, refErr
+	}
+
+	// Release the state lock requested by the force-unlock annotation, a
+	// stale lock would block the destroy too
+	util.ForceUnlockAnnotated(r.Client, input, resource, log)
 
-	// Check if the configmap already exists, if not create a new one
-	cmList := &corev1.ConfigMap{}
-	err = r.Get(ctx, types.NamespacedName{Name: resource.Name, Namespace: resource.Namespace}, cmList)
-	if err != nil && errors.IsNotFound(err) {
-		// Define a new ConfigMap
+	// Destroy the provisioned resources before the resource is deleted
+	if !resource.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(resource, terraformv1alpha1.DestroyFinalizer) {
+			return ctrl.Result{}, nil
+		}
 
-		cm := util.ConfigmapForResource(input)
-		log.Info("Creating a new Configmap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-		err = r.Create(ctx, cm)
-		if err != nil {
-			log.Error(err, "Failed to create new Confgimap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
+		// Show the resource as deleting while Terraform is running
+		setDeleting(&resource.Status.CommonStatus, resource.Generation)
+		if err = helper.Patch(ctx, resource); err != nil {
+			log.Error(err, "resource patch error")
 			return ctrl.Result{}, err
 		}
-		// Configmap created successfully - return and requeue
+		helper, _ = patch.NewHelper(resource, r.Client)
+
+		if resource.Spec.GetDeletionPolicy(provider) == terraformv1alpha1.DeletionPolicyOrphan {
+			// Keep the remote resource, only its state is removed
+			ids, err := util.OrphanTerraform(r.Client, input)
+			if err != nil {
+				log.Error(err, "Terraform Orphan Error")
+				resource.Status.Phase = "error"
+				resource.Status.Lock = util.LockStatus(err)
+				setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonOrphanFailed, err)
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Eventf(resource, corev1.EventTypeNormal, ReasonOrphaned, "Kept the cloud resources: %s", strings.Join(ids, ", "))
+		} else {
+			_, err = util.ExecuteTerraform(r.Client, input, true)
+			if err != nil {
+				log.Error(err, "Terraform Destroy Error")
+				resource.Status.Phase = "error"
+				resource.Status.Lock = util.LockStatus(err)
+				setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonDestroyFailed, err)
+				return ctrl.Result{}, err
+			}
+		}
+
+		controllerutil.RemoveFinalizer(resource, terraformv1alpha1.DestroyFinalizer)
+		return ctrl.Result{}, nil
+	}
+
+	// Add the finalizer before provisioning, so the resources are never left behind
+	if !controllerutil.ContainsFinalizer(resource, terraformv1alpha1.DestroyFinalizer) {
+		if err = deleteLegacySnapshot(ctx, r.Client, input); err != nil {
+			log.Error(err, "Failed to delete the legacy Configmap")
+			return ctrl.Result{}, err
+		}
+
+		controllerutil.AddFinalizer(resource, terraformv1alpha1.DestroyFinalizer)
+		// Finalizer added - return and requeue
 		return ctrl.Result{Requeue: true}, nil
-	} else if err != nil {
-		log.Error(err, "Failed to get Configmap")
-		return ctrl.Result{}, err
 	}
 
-	// Provision the Resource Resource by Terraform. It'll skip
-	// when `Phase` is `provisioned`.
-	if resource.Status.Phase == "" {
-		id, err = util.ExecuteTerraform(input, false)
+	// Wait for the referenced resources, the resource is reconciled again
+	// once they change
+	if refErr != nil {
+		log.Info("Waiting for the referenced resources", "reason", refErr.Error())
+		setWaiting(&resource.Status.CommonStatus, resource.Generation, refErr)
+		return ctrl.Result{}, nil
+	}
+	setDependenciesReady(&resource.Status.CommonStatus, resource.Generation)
 
+	// Read the user data, and check the instance is complete before it's
+	// provisioned
+	input.UserData, err = r.userData(ctx, resource)
+	if err == nil {
+		err = validateInstance(input)
+	}
+	if err != nil {
+		log.Error(err, "Invalid instance")
+		setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonInvalidInstance, err)
+		return ctrl.Result{}, err
+	}
+
+	// Provision the Resource Resource by Terraform. Once provisioned, it's
+	// applied again when the spec changed (new generation) or when the plan
+	// shows changes of the remote resource.
+	// The drift of the remote resource is checked by a plan every interval.
+	interval := resource.Spec.GetDriftCheckInterval()
+	next := nextDriftCheck(&resource.Status.CommonStatus, interval)
+
+	// Adopt the existing remote resource of a preset ID instead of creating
+	// a new one, then plan to report its differences from the spec. They're
+	// only applied once acknowledged, see driftPolicy.
+	if resource.Spec.ID != "" && resource.Status.LastAppliedGeneration == 0 {
+		err = util.ImportTerraform(r.Client, input, resource.Spec.ID)
+		resource.Status.Lock = util.LockStatus(err)
 		if err != nil {
+			log.Error(err, "Terraform Import Error")
+			if resource.Status.Lock == nil {
+				resource.Status.Phase = "error"
+			}
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonImportFailed, err)
+			return ctrl.Result{}, err
+		}
+		resource.Status.Phase = "imported"
+		setImported(&resource.Status.CommonStatus, resource.Generation)
+		next = 0
+	}
+
+	apply := resource.Status.Phase == "" || resource.Generation != resource.Status.LastAppliedGeneration
+	if !apply && next == 0 {
+		next = interval
+
+		plan, err := util.PlanTerraform(r.Client, input)
+		resource.Status.Lock = util.LockStatus(err)
+		if resource.Status.Lock != nil {
+			// The state is locked by another operation, retry on the next reconcile
+			log.Info("Terraform state is locked", "LockID", resource.Status.Lock.ID, "Stale", resource.Status.Lock.Stale)
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonPlanFailed, err)
+		} else if err != nil {
 			resource.Status.Phase = "error"
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonPlanFailed, err)
 		} else {
-			resource.Status.Phase = "provisioned"
-			resource.Spec.ID = id
+			log.Info("plan", "add", plan.Add, "change", plan.Change, "destroy", plan.Destroy)
+			resource.Status.Phase = util.PlanPhase(plan)
+			apply = setPlanned(&resource.Status.CommonStatus, resource.Generation, driftPolicy(&resource.Status.CommonStatus, &resource.Spec.CommonSpec, resource), plan)
+
+			// Observe the resources imported, or provisioned before they were observed
+			if resource.Status.AtProvider == nil {
+				if obs, err := util.ObserveTerraform(r.Client, input); err != nil {
+					log.Error(err, "Failed to observe the resource")
+				} else {
+					resource.Status.AtProvider = instanceObservation(obs)
+					resource.Status.Nodes = instanceNodes(obs)
+				}
+			}
 		}
-	} else {
-		status, err := util.PlanTerraform(input)
-		log.Info("status:" + status)
-		if err != nil {
+	}
+
+	if apply {
+		next = interval
+
+		obs, err = util.ExecuteTerraform(r.Client, input, false)
+		resource.Status.Lock = util.LockStatus(err)
+
+		if resource.Status.Lock != nil {
+			// The state is locked by another operation, retry on the next reconcile
+			log.Info("Terraform state is locked", "LockID", resource.Status.Lock.ID, "Stale", resource.Status.Lock.Stale)
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonApplyFailed, err)
+		} else if err != nil {
 			resource.Status.Phase = "error"
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonApplyFailed, err)
 		} else {
-			resource.Status.Phase = status
+			generation := resource.Generation
+			if resource.Spec.ID != obs.ID {
+				// Recording the ID bumps the generation, not the applied spec
+				resource.Spec.ID = obs.ID
+				generation++
+			}
+			resource.Status.Phase = "provisioned"
+			resource.Status.AtProvider = instanceObservation(obs)
+			resource.Status.Nodes = instanceNodes(obs)
+			setApplied(&resource.Status.CommonStatus, generation)
 		}
 	}
 	/*
 		if resource.Status.Phase != "provisioned" {
-			id, err = util.ExecuteTerraform(input, false)
+			id, err = util.ExecuteTerraform(r.Client, input, false)
 
 			if err != nil {
 				resource.Status.Phase = "error"
@@ -230,29 +319,132 @@ func (r *AWSInstanceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 			}
 		}
 	*/
+	// Publish the connection details of the provisioned instance, unless the
+	// reconcile failed
+	if ref := resource.Spec.WriteConnectionSecretToRef; ref != nil && resource.Status.LastAppliedGeneration != 0 && resource.Status.FailureReason == "" {
+		err = publishConnectionDetails(ctx, r.Client, r.Scheme, resource, ref, input, obs, instanceConnectionDetails)
+		if err != nil {
+			log.Error(err, "Failed to write the connection secret")
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonConnectionSecretFailed, err)
+			return ctrl.Result{}, err
+		}
+	}
+
 	//return ctrl.Result{}, nil
-	return ctrl.Result{RequeueAfter: time.Second * 60}, nil // Reconcile loop rescheduled after 60 seconds
+	return ctrl.Result{RequeueAfter: next}, nil // Reconcile loop rescheduled for the next drift check
 }
 
-// SearchResourceID returns TerraVars struct with resource id
-func (r *AWSInstanceReconciler) SearchResourceID(input util.TerraVars) util.TerraVars {
-	output := input
+// userData returns the user data of the instance, read from its ConfigMap
+// when it's set
+func (r *AWSInstanceReconciler) userData(ctx context.Context, resource *terraformv1alpha1.AWSInstance) (string, error) {
+	ref := resource.Spec.UserDataFrom
+	if ref == nil {
+		return resource.Spec.UserData, nil
+	}
+	if resource.Spec.UserData != "" {
+		return "", fmt.Errorf("only one of userData and userDataFrom can be set")
+	}
 
-	if input.SubnetName != "" && input.SubnetID == "" {
-		subnet := &terraformv1alpha1.AWSSubnet{}
-		r.Get(context.TODO(), types.NamespacedName{Name: input.SubnetName, Namespace: input.Namespace}, subnet)
-		output.SubnetID = subnet.Spec.ID
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: resource.Namespace}, configMap); err != nil {
+		return "", fmt.Errorf("failed to get the user data ConfigMap %s. %s", ref.Name, err)
 	}
-	if input.SGName != "" && input.SGID == "" {
-		sg := &terraformv1alpha1.AWSSecurityGroup{}
-		r.Get(context.TODO(), types.NamespacedName{Name: input.SGName, Namespace: input.Namespace}, sg)
-		output.SGID = sg.Spec.ID
+	userData, ok := configMap.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in the user data ConfigMap %s", ref.Key, ref.Name)
 	}
-	return output
+	return userData, nil
+}
+
+// validateInstance checks the addresses and volumes of the instance can be
+// provisioned
+func validateInstance(input util.TerraVars) error {
+	if input.PrivateIP != "" && input.InstanceCount > 1 {
+		return fmt.Errorf("privateIP can't be set for %d replicas", input.InstanceCount)
+	}
+	for _, volume := range input.Volumes {
+		if volume.DeviceName == "" {
+			return fmt.Errorf("deviceName of the volumes is required")
+		}
+	}
+	return nil
 }
 
 func (r *AWSInstanceReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&terraformv1alpha1.AWSInstance{}).
-		Complete(r)
+	blder := ctrl.NewControllerManagedBy(mgr).
+		For(&terraformv1alpha1.AWSInstance{})
+
+	// Reconcile the resource when the resources it references change
+	if err := watchReferences(mgr, blder, "AWSInstance"); err != nil {
+		return err
+	}
+
+	// Reconcile the instances when their user data ConfigMap changes
+	indexer := func(obj runtime.Object) []string {
+		if ref := obj.(*terraformv1alpha1.AWSInstance).Spec.UserDataFrom; ref != nil && ref.Name != "" {
+			return []string{ref.Name}
+		}
+		return nil
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &terraformv1alpha1.AWSInstance{}, userDataFromField, indexer); err != nil {
+		return err
+	}
+	blder.Watches(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+			return userDataRequests(r.Client, o.Meta.GetNamespace(), o.Meta.GetName())
+		}),
+	})
+	return blder.Complete(r)
+}
+
+// userDataRequests returns the requests of the instances reading their user
+// data from the ConfigMap
+func userDataRequests(c client.Client, namespace, name string) []reconcile.Request {
+	instances := &terraformv1alpha1.AWSInstanceList{}
+	if err := c.List(context.Background(), instances, client.InNamespace(namespace), client.MatchingFields{userDataFromField: name}); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, instance := range instances.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}})
+	}
+	return requests
+}
+
+// instanceObservation returns the observed state of the provisioned instance
+func instanceObservation(obs *util.Observation) *terraformv1alpha1.AWSInstanceObservation {
+	return &terraformv1alpha1.AWSInstanceObservation{
+		ARN:              obs.Attribute("arn"),
+		InstanceState:    obs.Attribute("instance_state"),
+		AvailabilityZone: obs.Attribute("availability_zone"),
+		PrivateIP:        obs.Attribute("private_ip"),
+		PrivateDNS:       obs.Attribute("private_dns"),
+		PublicIP:         obs.Attribute("public_ip"),
+		PublicDNS:        obs.Attribute("public_dns"),
+	}
+}
+
+// instanceNodes returns the provisioned instances of the replicas
+func instanceNodes(obs *util.Observation) []terraformv1alpha1.AWSInstanceNode {
+	nodes := []terraformv1alpha1.AWSInstanceNode{}
+	for i := range obs.Instances {
+		nodes = append(nodes, terraformv1alpha1.AWSInstanceNode{
+			ID:            obs.InstanceAttribute(i, "id"),
+			InstanceState: obs.InstanceAttribute(i, "instance_state"),
+			PrivateIP:     obs.InstanceAttribute(i, "private_ip"),
+			PublicIP:      obs.InstanceAttribute(i, "public_ip"),
+		})
+	}
+	return nodes
+}
+
+// instanceConnectionDetails returns the connection details of the provisioned instance
+func instanceConnectionDetails(obs *util.Observation) map[string][]byte {
+	return map[string][]byte{
+		"publicIP":   []byte(obs.Attribute("public_ip")),
+		"privateIP":  []byte(obs.Attribute("private_ip")),
+		"publicDNS":  []byte(obs.Attribute("public_dns")),
+		"privateDNS": []byte(obs.Attribute("private_dns")),
+	}
 }
@@ -19,16 +19,18 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
 	"github.com/tmax-cloud/terraform-operator/util"
@@ -37,8 +39,9 @@ import (
 // AWSKeyReconciler reconciles a AWSKey object
 type AWSKeyReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=awskeys,verbs=get;list;watch;create;update;patch;delete
@@ -48,7 +51,7 @@ type AWSKeyReconciler struct {
 func (r *AWSKeyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("awskey", req.NamespacedName)
-	var id string
+	var obs *util.Observation
 
 	// Fetch the AWS-Key instance
 	resource := &terraformv1alpha1.AWSKey{}
@@ -59,40 +62,6 @@ func (r *AWSKeyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
 			// Return and don't requeue
 			log.Info("`Resource` resource not found. Ignoring since object must be deleted")
-
-			cm := &corev1.ConfigMap{}
-			err = r.Get(ctx, req.NamespacedName, cm)
-			if err != nil {
-				if errors.IsNotFound(err) {
-					// Request object not found, could have been deleted after reconcile request.
-					// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
-					// Return and don't requeue
-					log.Info("ConfigMap resource not found. Ignoring since object must be deleted")
-					return ctrl.Result{}, nil
-				}
-				// Error reading the object - requeue the request.
-				log.Error(err, "Failed to get ConfigMap")
-				return ctrl.Result{}, err
-			}
-
-			// Recover "Resource" Data using ConfigMap
-			input := util.ConfigmapToVars(cm)
-
-			// Destroy the Provisioned Resources for Deleted Object (Resource)
-			//err = util.ExecuteTerraform_CLI(util.HCL_DIR, isDestroy)
-			destroy := true
-			id, err = util.ExecuteTerraform(input, destroy)
-			if err != nil {
-				log.Error(err, "Terraform Destroy Error")
-				return ctrl.Result{}, err
-			}
-
-			err = r.Delete(ctx, cm)
-			if err != nil {
-				log.Error(err, "Failed to delete new Confgimap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-				return ctrl.Result{}, err
-			}
-
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -124,6 +93,7 @@ func (r *AWSKeyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 
 	input.Name = resource.Name
 	input.Namespace = resource.Namespace
+	input.UID = string(resource.UID)
 	input.KeyName = resource.Name
 	input.Type = resource.Kind
 
@@ -133,33 +103,14 @@ func (r *AWSKeyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	if err != nil {
 		// Error reading the object - requeue the request.
 		log.Error(err, "Failed to get Provider")
+		setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonProviderNotFound, err)
 		return ctrl.Result{}, err
 	}
 
-	input.ProviderName = provider.Name
-	input.Cloud = provider.Spec.Cloud
-	input.Region = provider.Spec.Region
-
-	// AWS
-	input.AccessKey = provider.Spec.AWS.AccessKey
-	input.SecretKey = provider.Spec.AWS.SecretKey
-	// Azure
-	input.SubscriptionID = provider.Spec.Azure.SubscriptionID
-	input.ClientID = provider.Spec.Azure.ClientID
-	input.ClientSecret = provider.Spec.Azure.ClientSecret
-	input.TenantID = provider.Spec.Azure.TenantID
-
-	fmt.Println("ProviderName:" + input.ProviderName)
-	fmt.Println("Cloud:" + input.Cloud)
-	// AWS
-	fmt.Println("AccessKey:" + input.AccessKey)
-	fmt.Println("SecretKey:" + input.SecretKey)
-	fmt.Println("Region:" + input.Region)
-	// Azure
-	fmt.Println("AccessKey:" + input.SubscriptionID)
-	fmt.Println("ClientID:" + input.ClientID)
-	fmt.Println("ClietnSecret:" + input.ClientSecret)
-	fmt.Println("TenantID:" + input.TenantID)
+	// The credentials are read from the Secret of the provider when Terraform is executed
+	input = util.ProviderVars(input, provider)
+
+	log.V(1).Info("Provider", "provider", input.ProviderName, "cloud", input.Cloud, "region", input.Region)
 
 	// Set Provider as the owner and controller in Resource CR
 	if err = ctrl.SetControllerReference(provider, resource, r.Scheme); err != nil {
@@ -167,49 +118,161 @@ func (r *AWSKeyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 
-	// Check if the configmap already exists, if not create a new one
-	cmList := &corev1.ConfigMap{}
-	err = r.Get(ctx, types.NamespacedName{Name: resource.Name, Namespace: resource.Namespace}, cmList)
-	if err != nil && errors.IsNotFound(err) {
-		// Define a new ConfigMap
+	// Release the state lock requested by the force-unlock annotation, a
+	// stale lock would block the destroy too
+	util.ForceUnlockAnnotated(r.Client, input, resource, log)
 
-		cm := util.ConfigmapForResource(input)
-		log.Info("Creating a new Configmap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-		err = r.Create(ctx, cm)
-		if err != nil {
-			log.Error(err, "Failed to create new Confgimap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
+	// Destroy the provisioned resources before the resource is deleted
+	if !resource.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(resource, terraformv1alpha1.DestroyFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		// Show the resource as deleting while Terraform is running
+		setDeleting(&resource.Status.CommonStatus, resource.Generation)
+		if err = helper.Patch(ctx, resource); err != nil {
+			log.Error(err, "resource patch error")
 			return ctrl.Result{}, err
 		}
-		// Configmap created successfully - return and requeue
+		helper, _ = patch.NewHelper(resource, r.Client)
+
+		if resource.Spec.GetDeletionPolicy(provider) == terraformv1alpha1.DeletionPolicyOrphan {
+			// Keep the remote resource, only its state is removed
+			ids, err := util.OrphanTerraform(r.Client, input)
+			if err != nil {
+				log.Error(err, "Terraform Orphan Error")
+				resource.Status.Phase = "error"
+				resource.Status.Lock = util.LockStatus(err)
+				setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonOrphanFailed, err)
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Eventf(resource, corev1.EventTypeNormal, ReasonOrphaned, "Kept the cloud resources: %s", strings.Join(ids, ", "))
+		} else {
+			_, err = util.ExecuteTerraform(r.Client, input, true)
+			if err != nil {
+				log.Error(err, "Terraform Destroy Error")
+				resource.Status.Phase = "error"
+				resource.Status.Lock = util.LockStatus(err)
+				setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonDestroyFailed, err)
+				return ctrl.Result{}, err
+			}
+		}
+
+		controllerutil.RemoveFinalizer(resource, terraformv1alpha1.DestroyFinalizer)
+		return ctrl.Result{}, nil
+	}
+
+	// Add the finalizer before provisioning, so the resources are never left behind
+	if !controllerutil.ContainsFinalizer(resource, terraformv1alpha1.DestroyFinalizer) {
+		if err = deleteLegacySnapshot(ctx, r.Client, input); err != nil {
+			log.Error(err, "Failed to delete the legacy Configmap")
+			return ctrl.Result{}, err
+		}
+
+		controllerutil.AddFinalizer(resource, terraformv1alpha1.DestroyFinalizer)
+		// Finalizer added - return and requeue
 		return ctrl.Result{Requeue: true}, nil
-	} else if err != nil {
-		log.Error(err, "Failed to get Configmap")
-		return ctrl.Result{}, err
 	}
 
-	// Provision the Resource Resource by Terraform. It'll skip
-	// when `Phase` is `provisioned`.
-	if resource.Status.Phase == "" {
-		id, err = util.ExecuteTerraform(input, false)
+	// Register the public key of an existing key, or generate one
+	if resource.Spec.GeneratesKey() {
+		input.KeyAlgorithm = string(resource.Spec.GetAlgorithm())
+		input.KeySize = resource.Spec.GetKeySize()
+	} else {
+		input.PublicKey, err = r.publicKey(ctx, resource)
+	}
+	if err == nil {
+		err = validateKey(input)
+	}
+	if err != nil {
+		log.Error(err, "Invalid key")
+		setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonInvalidKey, err)
+		return ctrl.Result{}, err
+	}
 
+	// Provision the Resource Resource by Terraform. Once provisioned, it's
+	// applied again when the spec changed (new generation) or when the plan
+	// shows changes of the remote resource.
+	// The drift of the remote resource is checked by a plan every interval.
+	interval := resource.Spec.GetDriftCheckInterval()
+	next := nextDriftCheck(&resource.Status.CommonStatus, interval)
+
+	// Adopt the existing remote resource of a preset ID instead of creating
+	// a new one, then plan to report its differences from the spec. They're
+	// only applied once acknowledged, see driftPolicy.
+	if resource.Spec.ID != "" && resource.Status.LastAppliedGeneration == 0 {
+		err = util.ImportTerraform(r.Client, input, resource.Spec.ID)
+		resource.Status.Lock = util.LockStatus(err)
 		if err != nil {
+			log.Error(err, "Terraform Import Error")
+			if resource.Status.Lock == nil {
+				resource.Status.Phase = "error"
+			}
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonImportFailed, err)
+			return ctrl.Result{}, err
+		}
+		resource.Status.Phase = "imported"
+		setImported(&resource.Status.CommonStatus, resource.Generation)
+		next = 0
+	}
+
+	apply := resource.Status.Phase == "" || resource.Generation != resource.Status.LastAppliedGeneration
+	if !apply && next == 0 {
+		next = interval
+
+		plan, err := util.PlanTerraform(r.Client, input)
+		resource.Status.Lock = util.LockStatus(err)
+		if resource.Status.Lock != nil {
+			// The state is locked by another operation, retry on the next reconcile
+			log.Info("Terraform state is locked", "LockID", resource.Status.Lock.ID, "Stale", resource.Status.Lock.Stale)
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonPlanFailed, err)
+		} else if err != nil {
 			resource.Status.Phase = "error"
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonPlanFailed, err)
 		} else {
-			resource.Status.Phase = "provisioned"
-			resource.Spec.ID = id
+			log.Info("plan", "add", plan.Add, "change", plan.Change, "destroy", plan.Destroy)
+			resource.Status.Phase = util.PlanPhase(plan)
+			apply = setPlanned(&resource.Status.CommonStatus, resource.Generation, driftPolicy(&resource.Status.CommonStatus, &resource.Spec.CommonSpec, resource), plan)
+
+			// Observe the resources imported, or provisioned before they were observed
+			if resource.Status.AtProvider == nil {
+				if obs, err := util.ObserveTerraform(r.Client, input); err != nil {
+					log.Error(err, "Failed to observe the resource")
+				} else {
+					resource.Status.AtProvider = keyObservation(obs)
+				}
+			}
 		}
-	} else {
-		status, err := util.PlanTerraform(input)
-		log.Info("status:" + status)
-		if err != nil {
+	}
+
+	if apply {
+		next = interval
+
+		obs, err = util.ExecuteTerraform(r.Client, input, false)
+		resource.Status.Lock = util.LockStatus(err)
+
+		if resource.Status.Lock != nil {
+			// The state is locked by another operation, retry on the next reconcile
+			log.Info("Terraform state is locked", "LockID", resource.Status.Lock.ID, "Stale", resource.Status.Lock.Stale)
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonApplyFailed, err)
+		} else if err != nil {
 			resource.Status.Phase = "error"
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonApplyFailed, err)
 		} else {
-			resource.Status.Phase = status
+			generation := resource.Generation
+			if resource.Spec.ID != obs.ID {
+				// Recording the ID bumps the generation, not the applied spec
+				resource.Spec.ID = obs.ID
+				generation++
+			}
+			resource.Status.Phase = "provisioned"
+			resource.Status.AtProvider = keyObservation(obs)
+			setApplied(&resource.Status.CommonStatus, generation)
 		}
 	}
 	/*
 		if resource.Status.Phase != "provisioned" {
-			id, err = util.ExecuteTerraform(input, false)
+			id, err = util.ExecuteTerraform(r.Client, input, false)
 
 			if err != nil {
 				resource.Status.Phase = "error"
@@ -219,8 +282,64 @@ func (r *AWSKeyReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			}
 		}
 	*/
+	// Publish the connection details of the provisioned key pair, unless the
+	// reconcile failed
+	if ref := resource.GetWriteConnectionSecretToRef(); ref != nil && resource.Status.LastAppliedGeneration != 0 && resource.Status.FailureReason == "" {
+		err = publishConnectionDetails(ctx, r.Client, r.Scheme, resource, ref, input, obs, keyConnectionDetails)
+		if err != nil {
+			log.Error(err, "Failed to write the connection secret")
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonConnectionSecretFailed, err)
+			return ctrl.Result{}, err
+		}
+	}
+
 	//return ctrl.Result{}, nil
-	return ctrl.Result{RequeueAfter: time.Second * 60}, nil // Reconcile loop rescheduled after 60 seconds
+	return ctrl.Result{RequeueAfter: next}, nil // Reconcile loop rescheduled for the next drift check
+}
+
+// publicKey returns the public key of the existing key registered by the
+// resource
+func (r *AWSKeyReconciler) publicKey(ctx context.Context, resource *terraformv1alpha1.AWSKey) (string, error) {
+	ref := resource.Spec.PublicKeySecretRef
+	if ref == nil {
+		return resource.Spec.PublicKey, nil
+	}
+	if resource.Spec.PublicKey != "" {
+		return "", fmt.Errorf("only one of publicKey and publicKeySecretRef can be set")
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = terraformv1alpha1.PublicKeySecretKey
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: resource.Namespace}, secret); err != nil {
+		return "", fmt.Errorf("failed to get the public key Secret %s. %s", ref.Name, err)
+	}
+	publicKey, ok := secret.Data[key]
+	if !ok || len(publicKey) == 0 {
+		return "", fmt.Errorf("key %q not found in the public key Secret %s", key, ref.Name)
+	}
+	return strings.TrimSpace(string(publicKey)), nil
+}
+
+// validateKey checks the size of the generated key is supported by its
+// algorithm
+func validateKey(input util.TerraVars) error {
+	switch input.KeyAlgorithm {
+	case string(terraformv1alpha1.KeyAlgorithmRSA):
+		if input.KeySize < 2048 {
+			return fmt.Errorf("RSA key size %d is too small, it must be at least 2048", input.KeySize)
+		}
+	case string(terraformv1alpha1.KeyAlgorithmECDSA):
+		switch input.KeySize {
+		case 224, 256, 384, 521:
+		default:
+			return fmt.Errorf("ECDSA key size %d is not supported, it must be 224, 256, 384 or 521", input.KeySize)
+		}
+	}
+	return nil
 }
 
 func (r *AWSKeyReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -228,3 +347,24 @@ func (r *AWSKeyReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&terraformv1alpha1.AWSKey{}).
 		Complete(r)
 }
+
+// keyObservation returns the observed state of the provisioned key pair
+func keyObservation(obs *util.Observation) *terraformv1alpha1.AWSKeyObservation {
+	return &terraformv1alpha1.AWSKeyObservation{
+		Fingerprint: obs.Attribute("fingerprint"),
+	}
+}
+
+// keyConnectionDetails returns the connection details of the provisioned key pair
+func keyConnectionDetails(obs *util.Observation) map[string][]byte {
+	details := map[string][]byte{
+		"keyName":     []byte(obs.Attribute("key_name")),
+		"fingerprint": []byte(obs.Attribute("fingerprint")),
+		"publicKey":   []byte(obs.Attribute("public_key")),
+	}
+	// Only the generated keys have a private key
+	if privateKey := obs.ResourceAttribute("tls_private_key.example", "private_key_pem"); privateKey != "" {
+		details["privateKey"] = []byte(privateKey)
+	}
+	return details
+}
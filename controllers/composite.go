@@ -0,0 +1,122 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+)
+
+// component is a resource created by a composite kind
+type component interface {
+	referenceTarget
+	metav1.Object
+}
+
+// ensureComponent creates or updates the resource of a composite, owned by
+// it. mutate sets the fields of the spec managed by the composite, the other
+// ones, e.g. the ID, are kept.
+func ensureComponent(ctx context.Context, c client.Client, scheme *runtime.Scheme, owner metav1.Object, labels map[string]string, obj component, mutate func()) error {
+	_, err := controllerutil.CreateOrUpdate(ctx, c, obj, func() error {
+		objLabels := obj.GetLabels()
+		if objLabels == nil {
+			objLabels = map[string]string{}
+		}
+		for k, v := range labels {
+			objLabels[k] = v
+		}
+		obj.SetLabels(objLabels)
+
+		mutate()
+
+		// The provider is the controller of the resource, the composite
+		// only owns it so it's deleted along with the composite
+		return controllerutil.SetOwnerReference(owner, obj, scheme)
+	})
+	return err
+}
+
+// deleteStaleComponents deletes the resources of the list kind created by
+// the composite, selected by their labels, which are not kept anymore
+func deleteStaleComponents(ctx context.Context, c client.Client, namespace string, labels map[string]string, list runtime.Object, keep map[string]bool) error {
+	if err := c.List(ctx, list, client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil {
+		return err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		m, err := meta.Accessor(item)
+		if err != nil {
+			return err
+		}
+		if keep[m.GetName()] || m.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if err := c.Delete(ctx, item); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// componentStatus returns the status of the resource of a composite
+func componentStatus(kind string, obj component) terraformv1alpha1.ComponentStatus {
+	status := terraformv1alpha1.ComponentStatus{
+		Kind:  kind,
+		Name:  obj.GetName(),
+		ID:    obj.GetID(),
+		Ready: metav1.ConditionUnknown,
+	}
+	if ready := findCondition(obj.GetCommonStatus(), terraformv1alpha1.ConditionReady); ready != nil {
+		status.Ready = ready.Status
+		if ready.Status != metav1.ConditionTrue {
+			status.Message = ready.Message
+		}
+	}
+	return status
+}
+
+// setComponentsReady records the readiness of the resources of a composite,
+// which is Ready once all of them are Ready. It returns true if it's Ready.
+func setComponentsReady(status *terraformv1alpha1.CommonStatus, generation int64, components []terraformv1alpha1.ComponentStatus) bool {
+	setSynced(status, generation)
+
+	var waiting []string
+	for _, c := range components {
+		if c.Ready != metav1.ConditionTrue {
+			waiting = append(waiting, c.Kind+" "+c.Name)
+		}
+	}
+	if len(waiting) != 0 {
+		setCondition(status, generation, terraformv1alpha1.ConditionReady, metav1.ConditionFalse, ReasonComponentsNotReady, "waiting for "+strings.Join(waiting, ", "))
+		return false
+	}
+	setCondition(status, generation, terraformv1alpha1.ConditionReady, metav1.ConditionTrue, ReasonComponentsReady, "")
+	return true
+}
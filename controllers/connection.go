@@ -0,0 +1,63 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+	"github.com/tmax-cloud/terraform-operator/util"
+)
+
+// publishConnectionDetails writes the connection details of the provisioned
+// resource to the Secret of ref, owned by the resource. The details are taken
+// from the observation of the apply, if there was one. Otherwise they're read
+// from the state only when the Secret is missing, e.g. it was deleted.
+func publishConnectionDetails(ctx context.Context, c client.Client, scheme *runtime.Scheme, owner metav1.Object, ref *terraformv1alpha1.ConnectionSecretReference,
+	input util.TerraVars, obs *util.Observation, details func(obs *util.Observation) map[string][]byte) error {
+	key := types.NamespacedName{Name: ref.Name, Namespace: owner.GetNamespace()}
+
+	if obs == nil {
+		err := c.Get(ctx, key, &corev1.Secret{})
+		if err == nil || !errors.IsNotFound(err) {
+			return err
+		}
+		if obs, err = util.ObserveTerraform(c, input); err != nil {
+			return err
+		}
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	_, err := controllerutil.CreateOrUpdate(ctx, c, secret, func() error {
+		// Never overwrite a Secret which is not the one of the resource
+		if !secret.CreationTimestamp.IsZero() && !metav1.IsControlledBy(secret, owner) {
+			return fmt.Errorf("secret %s already exists and is not owned by %s", key, owner.GetName())
+		}
+		secret.Data = details(obs)
+		return controllerutil.SetControllerReference(owner, secret, scheme)
+	})
+	return err
+}
@@ -0,0 +1,183 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+)
+
+// dependentKind is a kind of resources referencing resources of another kind
+type dependentKind struct {
+	kind string
+
+	// obj and list are empty objects of the kind
+	obj, list runtime.Object
+
+	// field indexing the names of the referenced resources
+	field string
+
+	// names returns the names of the referenced resources
+	names func(obj runtime.Object) []string
+}
+
+// dependentKinds are the kinds referencing each kind. The references are
+// resolved before the resources are provisioned, and the referenced
+// resources are only destroyed once the resources referencing them are gone.
+var dependentKinds = map[string][]dependentKind{
+	"AWSVPC": {
+		{"AWSSubnet", &terraformv1alpha1.AWSSubnet{}, &terraformv1alpha1.AWSSubnetList{}, vpcRefField, func(obj runtime.Object) []string {
+			return []string{obj.(*terraformv1alpha1.AWSSubnet).Spec.GetVPCName()}
+		}},
+		{"AWSGateway", &terraformv1alpha1.AWSGateway{}, &terraformv1alpha1.AWSGatewayList{}, vpcRefField, func(obj runtime.Object) []string {
+			return []string{obj.(*terraformv1alpha1.AWSGateway).Spec.GetVPCName()}
+		}},
+		{"AWSSecurityGroup", &terraformv1alpha1.AWSSecurityGroup{}, &terraformv1alpha1.AWSSecurityGroupList{}, vpcRefField, func(obj runtime.Object) []string {
+			return []string{obj.(*terraformv1alpha1.AWSSecurityGroup).Spec.GetVPCName()}
+		}},
+		{"AWSRoute", &terraformv1alpha1.AWSRoute{}, &terraformv1alpha1.AWSRouteList{}, vpcRefField, func(obj runtime.Object) []string {
+			return []string{obj.(*terraformv1alpha1.AWSRoute).Spec.GetVPCName()}
+		}},
+	},
+	"AWSSubnet": {
+		{"AWSRoute", &terraformv1alpha1.AWSRoute{}, &terraformv1alpha1.AWSRouteList{}, subnetRefField, func(obj runtime.Object) []string {
+			return []string{obj.(*terraformv1alpha1.AWSRoute).Spec.GetSubnetName()}
+		}},
+		{"AWSInstance", &terraformv1alpha1.AWSInstance{}, &terraformv1alpha1.AWSInstanceList{}, subnetRefField, func(obj runtime.Object) []string {
+			return []string{obj.(*terraformv1alpha1.AWSInstance).Spec.GetSubnetName()}
+		}},
+	},
+	"AWSGateway": {
+		{"AWSRoute", &terraformv1alpha1.AWSRoute{}, &terraformv1alpha1.AWSRouteList{}, gatewayRefField, func(obj runtime.Object) []string {
+			return []string{obj.(*terraformv1alpha1.AWSRoute).Spec.GetGatewayName()}
+		}},
+	},
+	"AWSSecurityGroup": {
+		{"AWSSecurityGroupRule", &terraformv1alpha1.AWSSecurityGroupRule{}, &terraformv1alpha1.AWSSecurityGroupRuleList{}, securityGroupRefsField, func(obj runtime.Object) []string {
+			spec := obj.(*terraformv1alpha1.AWSSecurityGroupRule).Spec
+			return []string{spec.GetSGName(), spec.GetSourceSGName()}
+		}},
+		{"AWSInstance", &terraformv1alpha1.AWSInstance{}, &terraformv1alpha1.AWSInstanceList{}, securityGroupRefsField, func(obj runtime.Object) []string {
+			return obj.(*terraformv1alpha1.AWSInstance).Spec.GetSGs()
+		}},
+	},
+	"Network": {
+		{"Instance", &terraformv1alpha1.Instance{}, &terraformv1alpha1.InstanceList{}, networkField, func(obj runtime.Object) []string {
+			return []string{obj.(*terraformv1alpha1.Instance).Spec.Network}
+		}},
+	},
+}
+
+// holdDeletion returns the resources referencing the deleted resource of the
+// kind, as "Kind name", or nil once they're gone. When the resource has the
+// cascade-delete annotation, they're deleted with the annotation too.
+func holdDeletion(ctx context.Context, c client.Client, kind string, resource metav1.Object) ([]string, error) {
+	cascade := resource.GetAnnotations()[terraformv1alpha1.CascadeDeleteAnnotation] == "true"
+
+	var dependents []string
+	for _, dk := range dependentKinds[kind] {
+		list := dk.list.DeepCopyObject()
+		err := c.List(ctx, list, client.InNamespace(resource.GetNamespace()), client.MatchingFields{dk.field: resource.GetName()})
+		if err != nil {
+			return nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			m, err := meta.Accessor(item)
+			if err != nil {
+				return nil, err
+			}
+			dependents = append(dependents, dk.kind+" "+m.GetName())
+
+			if !cascade || m.GetDeletionTimestamp() != nil {
+				continue
+			}
+			if err := cascadeDelete(ctx, c, item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return dependents, nil
+}
+
+// cascadeDelete deletes the resource referencing a deleted resource, along
+// with the resources referencing it in turn
+func cascadeDelete(ctx context.Context, c client.Client, obj runtime.Object) error {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+
+	if m.GetAnnotations()[terraformv1alpha1.CascadeDeleteAnnotation] != "true" {
+		patch := client.MergeFrom(obj.DeepCopyObject())
+		annotations := m.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[terraformv1alpha1.CascadeDeleteAnnotation] = "true"
+		m.SetAnnotations(annotations)
+		if err := c.Patch(ctx, obj, patch); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+	}
+
+	if err := c.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// watchDependents reconciles the resources of the kind when a resource
+// referencing them changes, e.g. it's gone
+func watchDependents(blder *builder.Builder, kind string) {
+	for _, dk := range dependentKinds[kind] {
+		names := dk.names
+		blder.Watches(&source.Kind{Type: dk.obj.DeepCopyObject()}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+				var requests []reconcile.Request
+				for _, name := range names(o.Object) {
+					if name != "" {
+						requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: name, Namespace: o.Meta.GetNamespace()}})
+					}
+				}
+				return requests
+			}),
+		})
+	}
+}
+
+// dependentsMessage describes the resources holding the deletion
+func dependentsMessage(dependents []string) string {
+	return "waiting for the referencing resources to be deleted: " + strings.Join(dependents, ", ")
+}
@@ -0,0 +1,52 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/tmax-cloud/terraform-operator/util"
+)
+
+// deleteLegacySnapshot deletes the ConfigMap snapshot which older versions used
+// to destroy the cloud resources once the resource was gone. The destroy
+// finalizer replaces it, and the snapshot holds the provider credentials.
+func deleteLegacySnapshot(ctx context.Context, c client.Client, input util.TerraVars) error {
+	cm := &corev1.ConfigMap{}
+	err := c.Get(ctx, types.NamespacedName{Name: input.Name, Namespace: input.Namespace}, cm)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	// Only delete the ConfigMap if it's the snapshot of the resource
+	if cm.Data["Type"] != input.Type || cm.Data["Name"] != input.Name {
+		return nil
+	}
+
+	if err := c.Delete(ctx, cm); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -18,32 +18,322 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+	"github.com/tmax-cloud/terraform-operator/util"
 )
 
 // HCLReconciler reconciles a HCL object
 type HCLReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=hcls,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=hcls/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=terraform.tmax.io,resources=hcls/finalizers,verbs=update
 
+// Reconcile applies the Terraform code of the HCL with the provider of its
+// Provider, and records the outputs of the code
 func (r *HCLReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	_ = context.Background()
-	_ = r.Log.WithValues("hcl", req.NamespacedName)
+	ctx := context.Background()
+	log := r.Log.WithValues("hcl", req.NamespacedName)
+	var obs *util.Observation
 
-	// your logic here
+	// Fetch the HCL instance
+	resource := &terraformv1alpha1.HCL{}
+	err := r.Get(ctx, req.NamespacedName, resource)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("HCL resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		log.Error(err, "Failed to get HCL")
+		return ctrl.Result{}, err
+	}
 
-	return ctrl.Result{}, nil
+	helper, _ := patch.NewHelper(resource, r.Client)
+
+	defer func() {
+		if err := helper.Patch(ctx, resource); err != nil {
+			log.Error(err, "resource patch error")
+		}
+	}()
+
+	input := util.TerraVars{}
+
+	input.Name = resource.Name
+	input.Namespace = resource.Namespace
+	input.UID = string(resource.UID)
+	input.Type = "HCL"
+	input.HCLFiles = map[string]string{resource.Spec.GetPath(): resource.Spec.Content}
+
+	// Fetch the "Provider" instance related to "HCL" (HCL -> Provider)
+	provider := &terraformv1alpha1.Provider{}
+	err = r.Get(ctx, types.NamespacedName{Name: resource.Spec.Provider, Namespace: resource.Namespace}, provider)
+	if err != nil {
+		// Error reading the object - requeue the request.
+		log.Error(err, "Failed to get Provider")
+		setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonProviderNotFound, err)
+		return ctrl.Result{}, err
+	}
+
+	// The credentials are read from the Secret of the provider when Terraform is executed
+	input = util.ProviderVars(input, provider)
+
+	// Set Provider as the owner and controller in HCL CR
+	if err = ctrl.SetControllerReference(provider, resource, r.Scheme); err != nil {
+		log.Error(err, "Failed to set ownerReferences")
+		return ctrl.Result{}, err
+	}
+
+	// Release the state lock requested by the force-unlock annotation, a
+	// stale lock would block the destroy too
+	util.ForceUnlockAnnotated(r.Client, input, resource, log)
+
+	// Destroy the provisioned resources before the resource is deleted
+	if !resource.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(resource, terraformv1alpha1.DestroyFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		// The variables are required to destroy the code too, but their
+		// ConfigMaps and Secrets may be deleted with the HCL
+		input.HCLVars, err = r.vars(ctx, resource, true)
+		if err != nil {
+			log.Error(err, "Invalid variables")
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonInvalidVars, err)
+			return ctrl.Result{}, err
+		}
+
+		// Show the resource as deleting while Terraform is running
+		setDeleting(&resource.Status.CommonStatus, resource.Generation)
+		if err = helper.Patch(ctx, resource); err != nil {
+			log.Error(err, "resource patch error")
+			return ctrl.Result{}, err
+		}
+		helper, _ = patch.NewHelper(resource, r.Client)
+
+		if resource.Spec.GetDeletionPolicy(provider) == terraformv1alpha1.DeletionPolicyOrphan {
+			// Keep the remote resources, only their state is removed
+			ids, err := util.OrphanTerraform(r.Client, input)
+			if err != nil {
+				log.Error(err, "Terraform Orphan Error")
+				resource.Status.Phase = "error"
+				resource.Status.Lock = util.LockStatus(err)
+				setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonOrphanFailed, err)
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Eventf(resource, corev1.EventTypeNormal, ReasonOrphaned, "Kept the cloud resources: %s", strings.Join(ids, ", "))
+		} else {
+			_, err = util.ExecuteTerraform(r.Client, input, true)
+			if err != nil {
+				log.Error(err, "Terraform Destroy Error")
+				resource.Status.Phase = "error"
+				resource.Status.Lock = util.LockStatus(err)
+				setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonDestroyFailed, err)
+				return ctrl.Result{}, err
+			}
+		}
+
+		controllerutil.RemoveFinalizer(resource, terraformv1alpha1.DestroyFinalizer)
+		return ctrl.Result{}, nil
+	}
+
+	// Leave the cloud resources as they are while the HCL is paused, it's
+	// reconciled again when it's enabled
+	if !resource.Spec.GetEnabled() {
+		log.Info("HCL is paused")
+		resource.Status.Phase = "paused"
+		setPaused(&resource.Status.CommonStatus, resource.Generation)
+		return ctrl.Result{}, nil
+	}
+
+	// Add the finalizer before provisioning, so the resources are never left behind
+	if !controllerutil.ContainsFinalizer(resource, terraformv1alpha1.DestroyFinalizer) {
+		controllerutil.AddFinalizer(resource, terraformv1alpha1.DestroyFinalizer)
+		// Finalizer added - return and requeue
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	input.HCLVars, err = r.vars(ctx, resource, false)
+	if err != nil {
+		log.Error(err, "Invalid variables")
+		setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonInvalidVars, err)
+		return ctrl.Result{}, err
+	}
+
+	// Apply the code by Terraform. Once applied, it's applied again when the
+	// spec changed (new generation), when it's enabled again or when the plan
+	// shows changes of the remote resources.
+	// The drift of the remote resources is checked by a plan every interval.
+	interval := resource.Spec.GetDriftCheckInterval()
+	next := nextDriftCheck(&resource.Status.CommonStatus, interval)
+
+	apply := resource.Status.Phase == "" || resource.Status.Phase == "paused" || resource.Generation != resource.Status.LastAppliedGeneration
+	if !apply && next == 0 {
+		next = interval
+
+		plan, err := util.PlanTerraform(r.Client, input)
+		resource.Status.Lock = util.LockStatus(err)
+		if resource.Status.Lock != nil {
+			// The state is locked by another operation, retry on the next reconcile
+			log.Info("Terraform state is locked", "LockID", resource.Status.Lock.ID, "Stale", resource.Status.Lock.Stale)
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonPlanFailed, err)
+		} else if err != nil {
+			resource.Status.Phase = "error"
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonPlanFailed, err)
+		} else {
+			log.Info("plan", "add", plan.Add, "change", plan.Change, "destroy", plan.Destroy)
+			resource.Status.Phase = util.PlanPhase(plan)
+			apply = setPlanned(&resource.Status.CommonStatus, resource.Generation, resource.Spec.GetDriftPolicy(), plan)
+
+			// Observe the outputs of the code applied before they were recorded
+			if resource.Status.Outputs == nil {
+				if obs, err := util.ObserveTerraform(r.Client, input); err != nil {
+					log.Error(err, "Failed to observe the outputs")
+				} else {
+					resource.Status.Outputs = obs.OutputStrings(false)
+				}
+			}
+		}
+	}
+
+	if apply {
+		next = interval
+
+		obs, err = util.ExecuteTerraform(r.Client, input, false)
+		resource.Status.Lock = util.LockStatus(err)
+
+		if resource.Status.Lock != nil {
+			// The state is locked by another operation, retry on the next reconcile
+			log.Info("Terraform state is locked", "LockID", resource.Status.Lock.ID, "Stale", resource.Status.Lock.Stale)
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonApplyFailed, err)
+		} else if err != nil {
+			resource.Status.Phase = "error"
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonApplyFailed, err)
+		} else {
+			resource.Status.Phase = "provisioned"
+			resource.Status.Outputs = obs.OutputStrings(false)
+			setApplied(&resource.Status.CommonStatus, resource.Generation)
+		}
+	}
+
+	// Publish the outputs of the applied code, unless the reconcile failed
+	if ref := resource.Spec.WriteConnectionSecretToRef; ref != nil && resource.Status.LastAppliedGeneration != 0 && resource.Status.FailureReason == "" {
+		err = publishConnectionDetails(ctx, r.Client, r.Scheme, resource, ref, input, obs, outputConnectionDetails)
+		if err != nil {
+			log.Error(err, "Failed to write the connection secret")
+			setFailed(&resource.Status.CommonStatus, resource.Generation, ReasonConnectionSecretFailed, err)
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{RequeueAfter: next}, nil // Reconcile loop rescheduled for the next drift check
+}
+
+// vars returns the values of the variables of the code, the ones of Vars
+// taking precedence over the ones read from ConfigMaps and Secrets. When the
+// code is destroyed, the variables whose ConfigMap, Secret or key is missing
+// are null, the destroy doesn't depend on their values.
+func (r *HCLReconciler) vars(ctx context.Context, resource *terraformv1alpha1.HCL, destroy bool) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	for _, source := range resource.Spec.VarsFrom {
+		value, found, err := r.varFrom(ctx, resource.Namespace, source)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case found:
+			vars[source.Name] = value
+		case destroy:
+			vars[source.Name] = nil
+		default:
+			return nil, fmt.Errorf("the %s of variable %s is not found", varRefName(source), source.Name)
+		}
+	}
+
+	for name, value := range specVars(resource.Spec.Vars) {
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// varFrom reads the value of a variable from its ConfigMap or Secret, found
+// is false if the ConfigMap, the Secret or the key doesn't exist
+func (r *HCLReconciler) varFrom(ctx context.Context, namespace string, source terraformv1alpha1.HCLVarSource) (value string, found bool, err error) {
+	switch {
+	case source.ConfigMapKeyRef != nil && source.SecretKeyRef != nil:
+		return "", false, fmt.Errorf("only one of configMapKeyRef and secretKeyRef can be set for variable %s", source.Name)
+	case source.ConfigMapKeyRef != nil:
+		ref := source.ConfigMapKeyRef
+		configMap := &corev1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, configMap); err != nil {
+			if errors.IsNotFound(err) {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("failed to get the ConfigMap %s of variable %s. %s", ref.Name, source.Name, err)
+		}
+		value, found = configMap.Data[ref.Key]
+		return value, found, nil
+	case source.SecretKeyRef != nil:
+		ref := source.SecretKeyRef
+		key := ref.Key
+		if key == "" {
+			key = source.Name
+		}
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+			if errors.IsNotFound(err) {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("failed to get the Secret %s of variable %s. %s", ref.Name, source.Name, err)
+		}
+		data, found := secret.Data[key]
+		return string(data), found, nil
+	default:
+		return "", false, fmt.Errorf("one of configMapKeyRef and secretKeyRef must be set for variable %s", source.Name)
+	}
+}
+
+// varRefName describes the key of the ConfigMap or Secret of a variable
+func varRefName(source terraformv1alpha1.HCLVarSource) string {
+	if ref := source.ConfigMapKeyRef; ref != nil {
+		return fmt.Sprintf("key %q of the ConfigMap %s", ref.Key, ref.Name)
+	}
+	key := source.SecretKeyRef.Key
+	if key == "" {
+		key = source.Name
+	}
+	return fmt.Sprintf("key %q of the Secret %s", key, source.SecretKeyRef.Name)
+}
+
+// specVars returns the variables of the spec as JSON values, they're
+// converted to the types of the variables declared in the code
+func specVars(vars map[string]apiextensionsv1.JSON) map[string]interface{} {
+	values := map[string]interface{}{}
+	for name, value := range vars {
+		values[name] = json.RawMessage(value.Raw)
+	}
+	return values
 }
 
 func (r *HCLReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -51,3 +341,13 @@ func (r *HCLReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&terraformv1alpha1.HCL{}).
 		Complete(r)
 }
+
+// outputConnectionDetails returns all the outputs of the applied code,
+// including the sensitive ones
+func outputConnectionDetails(obs *util.Observation) map[string][]byte {
+	details := map[string][]byte{}
+	for name, value := range obs.OutputStrings(true) {
+		details[name] = []byte(value)
+	}
+	return details
+}
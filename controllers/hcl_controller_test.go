@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/states/statemgr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+	"github.com/tmax-cloud/terraform-operator/util"
+)
+
+func TestHCLDeleteStaleLock(t *testing.T) {
+	now := metav1.Now()
+	provider := &terraformv1alpha1.Provider{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "default", UID: "provider"},
+		Spec:       terraformv1alpha1.ProviderSpec{Cloud: util.CloudAWS},
+	}
+	hcl := &terraformv1alpha1.HCL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "code",
+			Namespace:         "default",
+			UID:               "code",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{terraformv1alpha1.DestroyFinalizer},
+		},
+		Spec: terraformv1alpha1.HCLSpec{
+			CommonSpec: terraformv1alpha1.CommonSpec{DeletionPolicy: terraformv1alpha1.DeletionPolicyOrphan},
+			Provider:   provider.Name,
+			Content:    `output "id" { value = "1" }`,
+		},
+	}
+	scheme := newTestScheme(t)
+	c := fake.NewFakeClientWithScheme(scheme, provider, hcl)
+
+	// The state is left locked by an operation which stopped during the destroy
+	input := util.TerraVars{Name: hcl.Name, Namespace: hcl.Namespace, UID: string(hcl.UID), Type: "HCL"}
+	key := client.ObjectKey{Namespace: hcl.Namespace, Name: util.StateSecretName(input)}
+	lockID, err := util.NewLeaseLock(c, key.Namespace, key.Name, nil).Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	lease := &coordinationv1.Lease{}
+	if err := c.Get(context.TODO(), key, lease); err != nil {
+		t.Fatal(err)
+	}
+	expired := metav1.NewMicroTime(time.Now().Add(-2 * util.DefaultLockDuration))
+	lease.Spec.RenewTime = &expired
+	if err := c.Update(context.TODO(), lease); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &HCLReconciler{Client: c, Log: ctrl.Log.WithName("test"), Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: hcl.Namespace, Name: hcl.Name}}
+	if _, err := r.Reconcile(req); err == nil {
+		t.Fatalf("Reconcile() expected an error while the state is locked")
+	}
+
+	// The force-unlock annotation releases the stale lock of the deleted HCL
+	if err := c.Get(context.TODO(), req.NamespacedName, hcl); err != nil {
+		t.Fatal(err)
+	}
+	hcl.Annotations = map[string]string{terraformv1alpha1.ForceUnlockAnnotation: lockID}
+	if err := c.Update(context.TODO(), hcl); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if err := c.Get(context.TODO(), key, lease); !errors.IsNotFound(err) {
+		t.Errorf("Reconcile() kept the stale Lease, error = %v", err)
+	}
+	hcl = &terraformv1alpha1.HCL{}
+	if err := c.Get(context.TODO(), req.NamespacedName, hcl); err != nil {
+		t.Fatal(err)
+	}
+	if len(hcl.Finalizers) != 0 {
+		t.Errorf("Reconcile() kept the finalizers %v of the deleted HCL", hcl.Finalizers)
+	}
+	if _, ok := hcl.Annotations[terraformv1alpha1.ForceUnlockAnnotation]; ok {
+		t.Errorf("Reconcile() kept the force-unlock annotation")
+	}
+}
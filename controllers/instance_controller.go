@@ -17,22 +17,25 @@ limitations under the License.
 package controllers
 
 import (
-	"reflect"
-
-	appsv1 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
 
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
-
-	"fmt"
-
-	"github.com/tmax-cloud/terraform-operator/util"
 )
 
 // InstanceReconciler reconciles a Instance object
@@ -46,295 +49,246 @@ type InstanceReconciler struct {
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=instances/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=instances/finalizers,verbs=update
 
+// Reconcile scales the AWSInstances of the replicas of the instance in the
+// subnets and the security group of its network. The replicas are replaced
+// when their image, type or key changes, keeping at most MaxUnavailable of
+// them unavailable.
 func (r *InstanceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	/*
-		ctx := context.Background()
-		log := r.Log.WithValues("instance", req.NamespacedName)
-
-
-			// Fetch the "Instacne" instance
-			instance := &terraformv1alpha1.Instance{}
-			err := r.Get(ctx, req.NamespacedName, instance)
-
-			if err != nil {
-				if errors.IsNotFound(err) {
-					// Request object not found, could have been deleted after reconcile request.
-					// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
-					// Return and don't requeue
-					log.Info("Instance resource not found. Ignoring since object must be deleted")
-
-					cm := &corev1.ConfigMap{}
-					err = r.Get(ctx, req.NamespacedName, cm)
-					if err != nil {
-						if errors.IsNotFound(err) {
-							// Request object not found, could have been deleted after reconcile request.
-							// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
-							// Return and don't requeue
-							log.Info("ConfigMap resource not found. Ignoring since object must be deleted")
-							return ctrl.Result{}, nil
-						}
-						// Error reading the object - requeue the request.
-						log.Error(err, "Failed to get ConfigMap")
-						return ctrl.Result{}, err
-					}
-
-					// Recover "Instance" Data using ConfigMap
-					input := r.configmapToVars(cm)
-
-					// Destroy the Provisioned Resources for Deleted Object (Network)
-					destroy := true
-					//err = util.ExecuteTerraform_CLI(util.HCL_DIR, isDestroy)
-					err = util.ExecuteTerraform(input, destroy)
-					if err != nil {
-						log.Error(err, "Terraform Destroy Error")
-						return ctrl.Result{}, err
-					}
-
-					err = r.Delete(ctx, cm)
-					if err != nil {
-						log.Error(err, "Failed to delete new Confgimap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-						return ctrl.Result{}, err
-					}
-
-					return ctrl.Result{}, nil
-				}
-				// Error reading the object - requeue the request.
-				log.Error(err, "Failed to get Instance")
-				return ctrl.Result{}, err
-			}
-
-			// your logic here
-			input := util.TerraVars{}
-
-			input.Namespace = instance.Namespace
-			input.InstanceName = instance.Name
-			input.InstanceType = instance.Spec.Type
-			input.ImageID = instance.Spec.Image
-			input.KeyName = instance.Spec.Key
-
-			instanceNetwork := instance.Spec.Network
-
-			fmt.Println("InstanceName:" + input.InstanceName)
-			fmt.Println("InstanceType:" + input.InstanceType)
-			fmt.Println("ImageID:" + input.ImageID)
-			fmt.Println("KeyName:" + input.KeyName)
-
-			// Fetch the "Network" instance related to "Instance" (Instance -> Network)
-			network := &terraformv1alpha1.Network{}
-			err = r.Get(ctx, types.NamespacedName{Name: instanceNetwork, Namespace: instance.Namespace}, network)
-			if err != nil {
-				// Error reading the object - requeue the request.
-				log.Error(err, "Failed to get Network")
-				return ctrl.Result{}, err
-			}
+	ctx := context.Background()
+	log := r.Log.WithValues("instance", req.NamespacedName)
+
+	// Fetch the Instance instance
+	instance := &terraformv1alpha1.Instance{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Instance resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		log.Error(err, "Failed to get Instance")
+		return ctrl.Result{}, err
+	}
 
-			// Fetch the "Provider" instance related to "Network" (Network -> Provider)
-			provider := &terraformv1alpha1.Provider{}
-			err = r.Get(ctx, types.NamespacedName{Name: network.Spec.Provider, Namespace: network.Namespace}, provider)
-			if err != nil {
-				// Error reading the object - requeue the request.
-				log.Error(err, "Failed to get Provider")
-				return ctrl.Result{}, err
-			}
+	// The replicas are deleted by the garbage collector
+	if !instance.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
 
-			input.NetworkName = network.Name
-			input.VPCCIDR = network.Spec.VPCCIDR
-			input.SubnetCIDR = network.Spec.SubnetCIDR
-			input.RouteCIDR = network.Spec.RouteCIDR
-
-			fmt.Println("NetworkName:" + input.NetworkName)
-			fmt.Println("VPCCIDR:" + input.VPCCIDR)
-			fmt.Println("SubnetCIDR:" + input.SubnetCIDR)
-			fmt.Println("RouteCIDR:" + input.RouteCIDR)
-			fmt.Println("NetworkProvider:" + network.Spec.Provider)
-
-			input.ProviderName = provider.Name
-			input.Cloud = provider.Spec.Cloud
-			input.Region = provider.Spec.Region
-
-			// AWS
-			input.AccessKey = provider.Spec.AWS.AccessKey
-			input.SecretKey = provider.Spec.AWS.SecretKey
-
-			// Azure
-			input.SubscriptionID = provider.Spec.Azure.SubscriptionID
-			input.ClientID = provider.Spec.Azure.ClientID
-			input.ClientSecret = provider.Spec.Azure.ClientSecret
-			input.TenantID = provider.Spec.Azure.TenantID
-
-			fmt.Println("ProviderName:" + input.ProviderName)
-			fmt.Println("Cloud:" + input.Cloud)
-			// AWS
-			fmt.Println("AccessKey:" + input.AccessKey)
-			fmt.Println("SecretKey:" + input.SecretKey)
-			fmt.Println("Region:" + input.Region)
-			// Azure
-			fmt.Println("AccessKey:" + input.SubscriptionID)
-			fmt.Println("ClientID:" + input.ClientID)
-			fmt.Println("ClietnSecret:" + input.ClientSecret)
-			fmt.Println("TenantID:" + input.TenantID)
-
-			//fileName := strings.ToLower(providerCloud) + "-instance.tf"
-			//terraDir := util.HCL_DIR + "/" + providerName
-
-			// Set Network as the owner and controller in Instance CR
-			ctrl.SetControllerReference(network, instance, r.Scheme)
-			if err = r.Update(ctx, instance); err != nil {
-				log.Error(err, "Failed to update Instance field - ownerReferences")
-				return ctrl.Result{}, err
-			}
+	helper, _ := patch.NewHelper(instance, r.Client)
+
+	defer func() {
+		if err := helper.Patch(ctx, instance); err != nil {
+			log.Error(err, "instance patch error")
+		}
+	}()
+
+	// Fetch the "Provider" instance related to "Instance" (Instance -> Provider)
+	provider := &terraformv1alpha1.Provider{}
+	err = r.Get(ctx, types.NamespacedName{Name: instance.Spec.Provider, Namespace: instance.Namespace}, provider)
+	if err != nil {
+		log.Error(err, "Failed to get Provider")
+		setFailed(&instance.Status.CommonStatus, instance.Generation, ReasonProviderNotFound, err)
+		return ctrl.Result{}, err
+	}
 
-			// Check if the configmap already exists, if not create a new one
-			cmList := &corev1.ConfigMap{}
-			err = r.Get(ctx, types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}, cmList)
-			if err != nil && errors.IsNotFound(err) {
-				// Define a new ConfigMap
-				cm := r.configmapForInstance(instance, input)
-				log.Info("Creating a new Configmap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-				err = r.Create(ctx, cm)
-				if err != nil {
-					log.Error(err, "Failed to create new Confgimap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-					return ctrl.Result{}, err
-				}
-				// Configmap created successfully - return and requeue
-				return ctrl.Result{Requeue: true}, nil
-			} else if err != nil {
-				log.Error(err, "Failed to get Configmap")
-				return ctrl.Result{}, err
-			}
+	// Set Provider as the owner and controller in Instance CR
+	if err = ctrl.SetControllerReference(provider, instance, r.Scheme); err != nil {
+		log.Error(err, "Failed to set ownerReferences")
+		return ctrl.Result{}, err
+	}
 
-			// Provision the Network Resource by Terraform. It'll skip
-			// when `Phase` is `provisioned`.
-			if instance.Status.Phase != "provisioned" {
-				err = util.ExecuteTerraform(input, false)
-			}
+	// Wait for the subnets and the security group of the network, the
+	// instance is reconciled again when the network changes
+	network := &terraformv1alpha1.Network{}
+	err = r.Get(ctx, types.NamespacedName{Name: instance.Spec.Network, Namespace: instance.Namespace}, network)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to get Network")
+		return ctrl.Result{}, err
+	}
+	if errors.IsNotFound(err) || len(network.Status.Subnets) == 0 || network.Status.SecurityGroup == "" {
+		err = &dependencyError{waiting: []string{"network " + instance.Spec.Network + " to be created"}}
+		log.Info("Waiting for the network", "network", instance.Spec.Network)
+		setWaiting(&instance.Status.CommonStatus, instance.Generation, err)
+		return ctrl.Result{}, nil
+	}
+	setDependenciesReady(&instance.Status.CommonStatus, instance.Generation)
+
+	replicas, err := r.scale(ctx, instance, network)
+	if err != nil {
+		log.Error(err, "Failed to scale the replicas")
+		instance.Status.Phase = "error"
+		setFailed(&instance.Status.CommonStatus, instance.Generation, ReasonComponentsFailed, err)
+		return ctrl.Result{}, err
+	}
 
-			// Set 'Phase' Status depending on the result of 'ExecuteTerraform'
-			if err != nil {
-				instance.Status.Phase = "error"
-				tErr := r.Status().Update(ctx, instance)
-				if tErr != nil {
-					log.Error(err, "Failed to update Instance Status")
-					return ctrl.Result{}, tErr
-				}
-				if err != nil {
-					log.Error(err, "Terraform Apply Error")
-					return ctrl.Result{}, err
-				}
-			} else {
-				instance.Status.Phase = "provisioned"
-				tErr := r.Status().Update(ctx, instance)
-				if tErr != nil {
-					log.Error(tErr, "Failed to update Instance Status")
-					return ctrl.Result{}, tErr
-				}
-			}
-	*/
+	// The instance is reconciled again when its replicas change
+	setReplicasStatus(instance, replicas)
 	return ctrl.Result{}, nil
 }
 
-// deploymentForInstance returns a network Deployment object
-func (r *InstanceReconciler) deploymentForInstance(m *terraformv1alpha1.Instance) *appsv1.Deployment {
-	ls := labelsForInstance(m.Name)
-	replicas := m.Spec.Size
-
-	dep := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      m.Name,
-			Namespace: m.Namespace,
-		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &replicas,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: ls,
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{{
-						Image:   "memcached:1.4.36-alpine",
-						Name:    "memcached",
-						Command: []string{"memcached", "-m=64", "-o", "modern", "-v"},
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: 11211,
-							Name:          "memcached",
-						}},
-					}},
-				},
-			},
-		},
+// scale creates, deletes and replaces the replicas of the instance. It
+// returns the replicas left.
+func (r *InstanceReconciler) scale(ctx context.Context, instance *terraformv1alpha1.Instance, network *terraformv1alpha1.Network) ([]*terraformv1alpha1.AWSInstance, error) {
+	list := &terraformv1alpha1.AWSInstanceList{}
+	err := r.List(ctx, list, client.InNamespace(instance.Namespace), client.MatchingLabels{terraformv1alpha1.InstanceLabel: instance.Name})
+	if err != nil {
+		return nil, err
 	}
-	// Set Provider instance as the owner and controller
-	ctrl.SetControllerReference(m, dep, r.Scheme)
-	return dep
-}
-
-// configmapForInstance returns a instance ConfigMap object
-func (r *InstanceReconciler) configmapForInstance(m *terraformv1alpha1.Instance, input util.TerraVars) *corev1.ConfigMap {
-	configMapData := make(map[string]string, 0)
 
-	e := reflect.ValueOf(&input).Elem()
+	hash := templateHash(instance.Spec)
+	var current, old []*terraformv1alpha1.AWSInstance
+	for i := range list.Items {
+		replica := &list.Items[i]
+		switch {
+		case !replica.DeletionTimestamp.IsZero():
+		case replica.Labels[terraformv1alpha1.TemplateHashLabel] == hash:
+			current = append(current, replica)
+		default:
+			old = append(old, replica)
+		}
+	}
 
-	for i := 0; i < e.NumField(); i++ {
-		varName := e.Type().Field(i).Name
-		//varType := e.Type().Field(i).Type
-		varValue := fmt.Sprintf("%v", e.Field(i).Interface())
+	size := int(instance.Spec.Size)
+	minAvailable := size - int(instance.Spec.GetMaxUnavailable())
+	available := countReady(current) + countReady(old)
+
+	// Delete the old replicas: the unavailable ones first, then the
+	// available ones as long as enough replicas are left available, unless
+	// there are more replicas than the size
+	sort.SliceStable(old, func(i, j int) bool {
+		return !isReplicaReady(old[i]) && isReplicaReady(old[j])
+	})
+	var kept []*terraformv1alpha1.AWSInstance
+	for i, replica := range old {
+		surplus := len(current)+len(old)-i > size
+		if isReplicaReady(replica) {
+			if !surplus && available <= minAvailable {
+				kept = append(kept, replica)
+				continue
+			}
+			available--
+		}
+		if err := r.Delete(ctx, replica); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
 
-		configMapData[varName] = varValue
+	// Scale the current replicas, the old ones left take the place of new
+	// ones until they're deleted
+	target := size - len(kept)
+	replicas := make([]*terraformv1alpha1.AWSInstance, target)
+	for _, replica := range current {
+		index, err := strconv.Atoi(replica.Labels[terraformv1alpha1.ReplicaLabel])
+		if err != nil || index < 0 || index >= target || replicas[index] != nil {
+			if err := r.Delete(ctx, replica); err != nil && !errors.IsNotFound(err) {
+				return nil, err
+			}
+			continue
+		}
+		replicas[index] = replica
 	}
 
-	cm := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      m.Name,
-			Namespace: m.Namespace,
-		},
-		Data: configMapData,
+	labels := map[string]string{
+		terraformv1alpha1.InstanceLabel:     instance.Name,
+		terraformv1alpha1.TemplateHashLabel: hash,
 	}
-	return cm
+	for i := range replicas {
+		replica := replicas[i]
+		if replica == nil {
+			replica = &terraformv1alpha1.AWSInstance{ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%s-%d", instance.Name, hash, i),
+				Namespace: instance.Namespace,
+			}}
+		}
+		labels[terraformv1alpha1.ReplicaLabel] = strconv.Itoa(i)
+
+		// The replicas are spread across the subnets of the network
+		subnet := network.Status.Subnets[i%len(network.Status.Subnets)]
+		err := ensureComponent(ctx, r.Client, r.Scheme, instance, labels, replica, func() {
+			replica.Spec.CommonSpec = instance.Spec.CommonSpec
+			replica.Spec.Provider = instance.Spec.Provider
+			replica.Spec.SubnetRef = &terraformv1alpha1.ResourceReference{Name: subnet}
+			replica.Spec.SecurityGroupRefs = []terraformv1alpha1.ResourceReference{{Name: network.Status.SecurityGroup}}
+			replica.Spec.Image = instance.Spec.Image
+			replica.Spec.Type = instance.Spec.Type
+			replica.Spec.Key = instance.Spec.Key
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create or update AWSInstance %s. %s", replica.Name, err)
+		}
+		replicas[i] = replica
+	}
+
+	return append(replicas, kept...), nil
 }
 
-// configmapToVars returns a Terraform Variable Struct
-func (r *InstanceReconciler) configmapToVars(cm *corev1.ConfigMap) util.TerraVars {
-
-	configMapData := cm.Data
-
-	output := util.TerraVars{
-		Namespace: configMapData["Namespace"],
-
-		ProviderName:   configMapData["ProviderName"],
-		Cloud:          configMapData["Cloud"],
-		AccessKey:      configMapData["AccessKey"],
-		SecretKey:      configMapData["SecretKey"],
-		Region:         configMapData["Region"],
-		SubscriptionID: configMapData["SubscriptionID"],
-		ClientID:       configMapData["ClientID"],
-		ClientSecret:   configMapData["ClientSecret"],
-		TenantID:       configMapData["TenantID"],
-
-		NetworkName: configMapData["NetworkName"],
-		VPCCIDR:     configMapData["VPCCIDR"],
-		SubnetCIDR:  configMapData["SubnetCIDR"],
-		RouteCIDR:   configMapData["RouteCIDR"],
-
-		InstanceName: configMapData["InstanceName"],
-		InstanceType: configMapData["InstanceType"],
-		ImageID:      configMapData["ImageID"],
-		KeyName:      configMapData["KeyName"],
+// setReplicasStatus records the replicas of the instance, which is Ready once
+// all of them are Ready and up to date
+func setReplicasStatus(instance *terraformv1alpha1.Instance, replicas []*terraformv1alpha1.AWSInstance) {
+	status := &instance.Status
+	hash := templateHash(instance.Spec)
+
+	status.Nodes = nil
+	status.Replicas = int32(len(replicas))
+	status.ReadyReplicas = 0
+	status.UpdatedReplicas = 0
+	for _, replica := range replicas {
+		status.Nodes = append(status.Nodes, replica.Name)
+		if isReplicaReady(replica) {
+			status.ReadyReplicas++
+		}
+		if replica.Labels[terraformv1alpha1.TemplateHashLabel] == hash {
+			status.UpdatedReplicas++
+		}
+	}
+	sort.Strings(status.Nodes)
+
+	setSynced(&status.CommonStatus, instance.Generation)
+	size := instance.Spec.Size
+	if status.Replicas == size && status.ReadyReplicas == size && status.UpdatedReplicas == size {
+		status.Phase = "provisioned"
+		setCondition(&status.CommonStatus, instance.Generation, terraformv1alpha1.ConditionReady, metav1.ConditionTrue, ReasonComponentsReady, "")
+		return
 	}
+	status.Phase = "provisioning"
+	message := fmt.Sprintf("%d of %d replicas are Ready, %d are up to date", status.ReadyReplicas, size, status.UpdatedReplicas)
+	setCondition(&status.CommonStatus, instance.Generation, terraformv1alpha1.ConditionReady, metav1.ConditionFalse, ReasonComponentsNotReady, message)
+}
 
-	return output
+// templateHash returns the hash of the fields of the spec which replace the
+// replicas when they change
+func templateHash(spec terraformv1alpha1.InstanceSpec) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s", spec.Network, spec.Image, spec.Type, spec.Key)
+	return rand.SafeEncodeString(fmt.Sprint(h.Sum32()))
 }
 
-// labelsForNetwork returns the labels for selecting the resources
-// belonging to the given Network CR name.
-func labelsForInstance(name string) map[string]string {
-	return map[string]string{"app": "instance", "instance_cr": name}
+// isReplicaReady returns true if the AWSInstance of a replica is Ready
+func isReplicaReady(replica *terraformv1alpha1.AWSInstance) bool {
+	ready := findCondition(&replica.Status.CommonStatus, terraformv1alpha1.ConditionReady)
+	return ready != nil && ready.Status == metav1.ConditionTrue
+}
+
+// countReady returns the number of Ready replicas
+func countReady(replicas []*terraformv1alpha1.AWSInstance) int {
+	n := 0
+	for _, replica := range replicas {
+		if isReplicaReady(replica) {
+			n++
+		}
+	}
+	return n
 }
 
 func (r *InstanceReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	blder := ctrl.NewControllerManagedBy(mgr).
 		For(&terraformv1alpha1.Instance{}).
-		Complete(r)
+		Watches(&source.Kind{Type: &terraformv1alpha1.AWSInstance{}}, &handler.EnqueueRequestForOwner{OwnerType: &terraformv1alpha1.Instance{}})
+
+	// Reconcile the instance when its network changes
+	if err := watchReferences(mgr, blder, "Instance"); err != nil {
+		return err
+	}
+	return blder.Complete(r)
 }
@@ -17,22 +17,21 @@ limitations under the License.
 package controllers
 
 import (
-	appsv1 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"context"
+	"fmt"
 
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
-
-	//"os/exec"
-	"fmt"
-	"reflect"
-
-	"github.com/tmax-cloud/terraform-operator/util"
 )
 
 // NetworkReconciler reconciles a Network object
@@ -46,230 +45,215 @@ type NetworkReconciler struct {
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=networks/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=networks/finalizers,verbs=update
 
+// Reconcile creates the AWS resources of the network: a VPC with an internet
+// gateway, a subnet and a route table per subnet, and a security group with
+// the baseline rules. The network is Ready once all of them are Ready.
 func (r *NetworkReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	/*
-		ctx := context.Background()
-		log := r.Log.WithValues("network", req.NamespacedName)
-
-
-			// Fetch the Network instance
-			network := &terraformv1alpha1.Network{}
-			err := r.Get(ctx, req.NamespacedName, network)
-			if err != nil {
-				if errors.IsNotFound(err) {
-					// Request object not found, could have been deleted after reconcile request.
-					// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
-					// Return and don't requeue
-					log.Info("Network resource not found. Ignoring since object must be deleted")
-
-					cm := &corev1.ConfigMap{}
-					err = r.Get(ctx, req.NamespacedName, cm)
-					if err != nil {
-						if errors.IsNotFound(err) {
-							// Request object not found, could have been deleted after reconcile request.
-							// Owned objects are automatically garbage collected. For additional cleanup logic use finalizers.
-							// Return and don't requeue
-							log.Info("ConfigMap resource not found. Ignoring since object must be deleted")
-							return ctrl.Result{}, nil
-						}
-						// Error reading the object - requeue the request.
-						log.Error(err, "Failed to get ConfigMap")
-						return ctrl.Result{}, err
-					}
-
-					// Recover "Network" Data using ConfigMap
-					input := r.configmapToVars(cm)
-
-					// Destroy the Provisioned Resources for Deleted Object (Network)
-					//err = util.ExecuteTerraform_CLI(util.HCL_DIR, isDestroy)
-					destroy := true
-					err = util.ExecuteTerraform(input, destroy)
-					if err != nil {
-						log.Error(err, "Terraform Destroy Error")
-						return ctrl.Result{}, err
-					}
-
-					err = r.Delete(ctx, cm)
-					if err != nil {
-						log.Error(err, "Failed to delete new Confgimap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-						return ctrl.Result{}, err
-					}
-
-					return ctrl.Result{}, nil
-				}
-				// Error reading the object - requeue the request.
-				log.Error(err, "Failed to get Network")
-				return ctrl.Result{}, err
-			}
-
-			// your logic here
-			input := util.TerraVars{}
-
-			input.Namespace = network.Namespace
-			input.NetworkName = network.Name
-			input.VPCCIDR = network.Spec.VPCCIDR
-			input.SubnetCIDR = network.Spec.SubnetCIDR
-			input.RouteCIDR = network.Spec.RouteCIDR
-
-			fmt.Println("NetworkName:" + input.NetworkName)
-			fmt.Println("VPCCIDR:" + input.VPCCIDR)
-			fmt.Println("SubnetCIDR:" + input.SubnetCIDR)
-			fmt.Println("RouteCIDR:" + input.RouteCIDR)
-			fmt.Println("NetworkProvider:" + network.Spec.Provider)
-
-			// Fetch the "Provider" instance related to "Network" (Network -> Provider)
-			provider := &terraformv1alpha1.Provider{}
-			err = r.Get(ctx, types.NamespacedName{Name: network.Spec.Provider, Namespace: network.Namespace}, provider)
-			if err != nil {
-				// Error reading the object - requeue the request.
-				log.Error(err, "Failed to get Provider")
-				return ctrl.Result{}, err
-			}
-
-			input.ProviderName = provider.Name
-			input.Cloud = provider.Spec.Cloud
-			input.Region = provider.Spec.Region
-
-			// AWS
-			input.AccessKey = provider.Spec.AWS.AccessKey
-			input.SecretKey = provider.Spec.AWS.SecretKey
-			// Azure
-			input.SubscriptionID = provider.Spec.Azure.SubscriptionID
-			input.ClientID = provider.Spec.Azure.ClientID
-			input.ClientSecret = provider.Spec.Azure.ClientSecret
-			input.TenantID = provider.Spec.Azure.TenantID
+	ctx := context.Background()
+	log := r.Log.WithValues("network", req.NamespacedName)
+
+	// Fetch the Network instance
+	network := &terraformv1alpha1.Network{}
+	err := r.Get(ctx, req.NamespacedName, network)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Network resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		// Error reading the object - requeue the request.
+		log.Error(err, "Failed to get Network")
+		return ctrl.Result{}, err
+	}
 
-			fmt.Println("ProviderName:" + input.ProviderName)
-			fmt.Println("Cloud:" + input.Cloud)
-			// AWS
-			fmt.Println("AccessKey:" + input.AccessKey)
-			fmt.Println("SecretKey:" + input.SecretKey)
-			fmt.Println("Region:" + input.Region)
-			// Azure
-			fmt.Println("AccessKey:" + input.SubscriptionID)
-			fmt.Println("ClientID:" + input.ClientID)
-			fmt.Println("ClietnSecret:" + input.ClientSecret)
-			fmt.Println("TenantID:" + input.TenantID)
+	// The resources of the network are deleted by the garbage collector,
+	// each one once the resources referencing it are gone
+	if !network.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
 
-			//fileName := strings.ToLower(providerCloud) + "-network.tf"
-			//terraDir := util.HCL_DIR + "/" + networkProvider
+	helper, _ := patch.NewHelper(network, r.Client)
+
+	defer func() {
+		if err := helper.Patch(ctx, network); err != nil {
+			log.Error(err, "network patch error")
+		}
+	}()
+
+	// Fetch the "Provider" instance related to "Network" (Network -> Provider)
+	provider := &terraformv1alpha1.Provider{}
+	err = r.Get(ctx, types.NamespacedName{Name: network.Spec.Provider, Namespace: network.Namespace}, provider)
+	if err != nil {
+		log.Error(err, "Failed to get Provider")
+		setFailed(&network.Status.CommonStatus, network.Generation, ReasonProviderNotFound, err)
+		return ctrl.Result{}, err
+	}
 
-			// Set Provider as the owner and controller in Network CR
-			ctrl.SetControllerReference(provider, network, r.Scheme)
-			if err = r.Update(ctx, network); err != nil {
-				log.Error(err, "Failed to update Network field - ownerReferences")
-				return ctrl.Result{}, err
-			}
+	// Set Provider as the owner and controller in Network CR
+	if err = ctrl.SetControllerReference(provider, network, r.Scheme); err != nil {
+		log.Error(err, "Failed to set ownerReferences")
+		return ctrl.Result{}, err
+	}
 
-			// Check if the configmap already exists, if not create a new one
-			cmList := &corev1.ConfigMap{}
-			err = r.Get(ctx, types.NamespacedName{Name: network.Name, Namespace: network.Namespace}, cmList)
-			if err != nil && errors.IsNotFound(err) {
-				// Define a new ConfigMap
-				cm := r.configmapForNetwork(network, input)
-				log.Info("Creating a new Configmap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-				err = r.Create(ctx, cm)
-				if err != nil {
-					log.Error(err, "Failed to create new Confgimap", "Configmap.Namespace", cm.Namespace, "Configmap.Name", cm.Name)
-					return ctrl.Result{}, err
-				}
-				// Configmap created successfully - return and requeue
-				return ctrl.Result{Requeue: true}, nil
-			} else if err != nil {
-				log.Error(err, "Failed to get Configmap")
-				return ctrl.Result{}, err
-			}
+	if network.Spec.VPCCIDR == "" || len(network.Spec.GetSubnets()) == 0 {
+		err = fmt.Errorf("vpccidr and at least one subnet are required")
+		log.Error(err, "Invalid network")
+		setFailed(&network.Status.CommonStatus, network.Generation, ReasonInvalidNetwork, err)
+		return ctrl.Result{}, err
+	}
 
-			// Provision the Network Resource by Terraform. It'll skip
-			// when `Phase` is `provisioned`.
-			if network.Status.Phase != "provisioned" {
-				err = util.ExecuteTerraform(input, false)
-			}
+	components, err := r.ensureComponents(ctx, network)
+	if err != nil {
+		log.Error(err, "Failed to create the resources of the network")
+		network.Status.Phase = "error"
+		setFailed(&network.Status.CommonStatus, network.Generation, ReasonComponentsFailed, err)
+		return ctrl.Result{}, err
+	}
 
-			// Set 'Phase' Status depending on the result of 'ExecuteTerraform'
-			if err != nil {
-				network.Status.Phase = "error"
-				tErr := r.Status().Update(ctx, network)
-				if tErr != nil {
-					log.Error(err, "Failed to update Network Status")
-					return ctrl.Result{}, tErr
-				}
-				if err != nil {
-					log.Error(err, "Terraform Apply Error")
-					return ctrl.Result{}, err
-				}
-			} else {
-				network.Status.Phase = "provisioned"
-				tErr := r.Status().Update(ctx, network)
-				if tErr != nil {
-					log.Error(tErr, "Failed to update Network Status")
-					return ctrl.Result{}, tErr
-				}
-			}
-	*/
+	// The network is reconciled again when its resources change
+	network.Status.Components = components
+	if setComponentsReady(&network.Status.CommonStatus, network.Generation, components) {
+		network.Status.Phase = "provisioned"
+	} else {
+		network.Status.Phase = "provisioning"
+	}
 	return ctrl.Result{}, nil
 }
 
-// configmapForNetwork returns a network ConfigMap object
-func (r *NetworkReconciler) configmapForNetwork(m *terraformv1alpha1.Network, input util.TerraVars) *corev1.ConfigMap {
-	configMapData := make(map[string]string, 0)
-
-	e := reflect.ValueOf(&input).Elem()
-
-	for i := 0; i < e.NumField(); i++ {
-		varName := e.Type().Field(i).Name
-		//varType := e.Type().Field(i).Type
-		varValue := fmt.Sprintf("%v", e.Field(i).Interface())
-
-		configMapData[varName] = varValue
+// ensureComponents creates or updates the resources of the network, and
+// deletes the subnets which were removed from the spec. It returns their
+// status.
+func (r *NetworkReconciler) ensureComponents(ctx context.Context, network *terraformv1alpha1.Network) ([]terraformv1alpha1.ComponentStatus, error) {
+	labels := map[string]string{terraformv1alpha1.NetworkLabel: network.Name}
+	spec := network.Spec
+	var components []terraformv1alpha1.ComponentStatus
+
+	ensure := func(kind string, obj component, mutate func()) error {
+		obj.SetNamespace(network.Namespace)
+		if err := ensureComponent(ctx, r.Client, r.Scheme, network, labels, obj, mutate); err != nil {
+			return fmt.Errorf("failed to create or update %s %s. %s", kind, obj.GetName(), err)
+		}
+		components = append(components, componentStatus(kind, obj))
+		return nil
 	}
 
-	cm := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      m.Name,
-			Namespace: m.Namespace,
-		},
-		Data: configMapData,
+	vpc := &terraformv1alpha1.AWSVPC{ObjectMeta: metav1.ObjectMeta{Name: network.Name + "-vpc"}}
+	err := ensure("AWSVPC", vpc, func() {
+		vpc.Spec.CommonSpec = spec.CommonSpec
+		vpc.Spec.Provider = spec.Provider
+		vpc.Spec.CIDR = spec.VPCCIDR
+	})
+	if err != nil {
+		return nil, err
+	}
+	vpcRef := &terraformv1alpha1.ResourceReference{Name: vpc.Name}
+
+	gateway := &terraformv1alpha1.AWSGateway{ObjectMeta: metav1.ObjectMeta{Name: network.Name + "-gateway"}}
+	err = ensure("AWSGateway", gateway, func() {
+		gateway.Spec.CommonSpec = spec.CommonSpec
+		gateway.Spec.Provider = spec.Provider
+		gateway.Spec.VPCRef = vpcRef
+	})
+	if err != nil {
+		return nil, err
 	}
-	return cm
-}
-
-// configmapToVars returns a Terraform Variable Struct
-func (r *NetworkReconciler) configmapToVars(cm *corev1.ConfigMap) util.TerraVars {
-
-	configMapData := cm.Data
-
-	output := util.TerraVars{
-		Namespace: configMapData["Namespace"],
-
-		ProviderName:   configMapData["ProviderName"],
-		Cloud:          configMapData["Cloud"],
-		AccessKey:      configMapData["AccessKey"],
-		SecretKey:      configMapData["SecretKey"],
-		Region:         configMapData["Region"],
-		SubscriptionID: configMapData["SubscriptionID"],
-		ClientID:       configMapData["ClientID"],
-		ClientSecret:   configMapData["ClientSecret"],
-		TenantID:       configMapData["TenantID"],
 
-		NetworkName: configMapData["NetworkName"],
-		VPCCIDR:     configMapData["VPCCIDR"],
-		SubnetCIDR:  configMapData["SubnetCIDR"],
-		RouteCIDR:   configMapData["RouteCIDR"],
+	// A subnet and a route table to the internet gateway per subnet
+	subnets := map[string]bool{}
+	routes := map[string]bool{}
+	network.Status.Subnets = nil
+	for i, s := range spec.GetSubnets() {
+		subnet := &terraformv1alpha1.AWSSubnet{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-subnet-%d", network.Name, i)}}
+		err = ensure("AWSSubnet", subnet, func() {
+			subnet.Spec.CommonSpec = spec.CommonSpec
+			subnet.Spec.Provider = spec.Provider
+			subnet.Spec.VPCRef = vpcRef
+			subnet.Spec.CIDR = s.CIDR
+			subnet.Spec.Zone = s.Zone
+		})
+		if err != nil {
+			return nil, err
+		}
+		subnets[subnet.Name] = true
+		network.Status.Subnets = append(network.Status.Subnets, subnet.Name)
+
+		route := &terraformv1alpha1.AWSRoute{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-route-%d", network.Name, i)}}
+		err = ensure("AWSRoute", route, func() {
+			route.Spec.CommonSpec = spec.CommonSpec
+			route.Spec.Provider = spec.Provider
+			route.Spec.VPCRef = vpcRef
+			route.Spec.SubnetRef = &terraformv1alpha1.ResourceReference{Name: subnet.Name}
+			route.Spec.GatewayRef = &terraformv1alpha1.ResourceReference{Name: gateway.Name}
+			route.Spec.CIDR = spec.GetRouteCIDR()
+		})
+		if err != nil {
+			return nil, err
+		}
+		routes[route.Name] = true
+	}
+	if err := deleteStaleComponents(ctx, r.Client, network.Namespace, labels, &terraformv1alpha1.AWSRouteList{}, routes); err != nil {
+		return nil, err
+	}
+	if err := deleteStaleComponents(ctx, r.Client, network.Namespace, labels, &terraformv1alpha1.AWSSubnetList{}, subnets); err != nil {
+		return nil, err
 	}
 
-	return output
-}
+	sg := &terraformv1alpha1.AWSSecurityGroup{ObjectMeta: metav1.ObjectMeta{Name: network.Name + "-sg"}}
+	err = ensure("AWSSecurityGroup", sg, func() {
+		sg.Spec.CommonSpec = spec.CommonSpec
+		sg.Spec.Provider = spec.Provider
+		sg.Spec.VPCRef = vpcRef
+	})
+	if err != nil {
+		return nil, err
+	}
+	sgRef := &terraformv1alpha1.ResourceReference{Name: sg.Name}
+
+	// The baseline rules: the traffic inside the VPC and SSH are allowed
+	// in, everything is allowed out
+	for _, rule := range []struct {
+		name, ruleType, fromPort, toPort, protocol string
+		cidrs                                      []string
+	}{
+		{"internal", "ingress", "0", "0", "-1", []string{spec.VPCCIDR}},
+		{"ssh", "ingress", "22", "22", "tcp", spec.GetSSHCIDRs()},
+		{"egress", "egress", "0", "0", "-1", []string{"0.0.0.0/0"}},
+	} {
+		sgRule := &terraformv1alpha1.AWSSecurityGroupRule{ObjectMeta: metav1.ObjectMeta{Name: network.Name + "-" + rule.name}}
+		err = ensure("AWSSecurityGroupRule", sgRule, func() {
+			sgRule.Spec.CommonSpec = spec.CommonSpec
+			sgRule.Spec.Provider = spec.Provider
+			sgRule.Spec.SecurityGroupRef = sgRef
+			sgRule.Spec.Type = rule.ruleType
+			sgRule.Spec.FromPort = rule.fromPort
+			sgRule.Spec.ToPort = rule.toPort
+			sgRule.Spec.Protocol = rule.protocol
+			sgRule.Spec.CIDRs = rule.cidrs
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
-// labelsForNetwork returns the labels for selecting the resources
-// belonging to the given Network CR name.
-func labelsForNetwork(name string) map[string]string {
-	return map[string]string{"app": "network", "network_cr": name}
+	network.Status.VPC = vpc.Name
+	network.Status.SecurityGroup = sg.Name
+	return components, nil
 }
 
 func (r *NetworkReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&terraformv1alpha1.Network{}).
-		Owns(&appsv1.Deployment{}).
-		Complete(r)
+	blder := ctrl.NewControllerManagedBy(mgr).
+		For(&terraformv1alpha1.Network{})
+
+	// Reconcile the network when its resources change. The provider is
+	// their controller, the network is only one of their owners.
+	for _, obj := range []runtime.Object{
+		&terraformv1alpha1.AWSVPC{},
+		&terraformv1alpha1.AWSGateway{},
+		&terraformv1alpha1.AWSSubnet{},
+		&terraformv1alpha1.AWSRoute{},
+		&terraformv1alpha1.AWSSecurityGroup{},
+		&terraformv1alpha1.AWSSecurityGroupRule{},
+	} {
+		blder.Watches(&source.Kind{Type: obj}, &handler.EnqueueRequestForOwner{OwnerType: &terraformv1alpha1.Network{}})
+	}
+	return blder.Complete(r)
 }
@@ -18,16 +18,23 @@ package controllers
 
 import (
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"context"
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+	"github.com/tmax-cloud/terraform-operator/util"
 
 	"fmt"
 )
@@ -35,8 +42,9 @@ import (
 // ProviderReconciler reconciles a Provider object
 type ProviderReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
 }
 
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=providers,verbs=get;list;watch;create;update;patch;delete
@@ -44,6 +52,9 @@ type ProviderReconciler struct {
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=providers/finalizers,verbs=update
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;
 
 func (r *ProviderReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
@@ -66,41 +77,185 @@ func (r *ProviderReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 
-	// your logic here
-	providerName := provider.Name
-	providerCloud := provider.Spec.Cloud
-	providerRegion := provider.Spec.Region
-
-	// AWS
-	providerAK := provider.Spec.AWS.AccessKey
-	providerSK := provider.Spec.AWS.SecretKey
-
-	// Azure
-	providerSubID := provider.Spec.Azure.SubscriptionID
-	providerClientID := provider.Spec.Azure.ClientID
-	providerClientSecret := provider.Spec.Azure.ClientSecret
-	providerTenantID := provider.Spec.Azure.TenantID
-
-	//fileName := strings.ToLower(providerCloud) + "-provider.tf"
-
-	fmt.Println("providerName:" + providerName)
-	fmt.Println("providerCloud:" + providerCloud)
-	// AWS
-	fmt.Println("providerAK:" + providerAK)
-	fmt.Println("providerSK:" + providerSK)
-	fmt.Println("providerRegion:" + providerRegion)
-	// Azure
-	fmt.Println("providerSubID:" + providerSubID)
-	fmt.Println("providerClientID:" + providerClientID)
-	fmt.Println("providerClientSecret:" + providerClientSecret)
-	fmt.Println("providerTenantID:" + providerTenantID)
+	log.V(1).Info("Provider", "cloud", provider.Spec.Cloud, "region", provider.Spec.Region)
+
+	// Hold the deletion until the resources using the provider are gone, they
+	// need its credentials to destroy their cloud resources
+	if !provider.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(provider, terraformv1alpha1.ProviderFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		users, err := r.users(ctx, provider)
+		if err != nil {
+			log.Error(err, "Failed to get the resources using the Provider")
+			return ctrl.Result{}, err
+		}
+		if len(users) != 0 {
+			// The resources are deleted with the provider: the garbage
+			// collector only deletes them once the provider is gone, unless
+			// it's deleted in the foreground
+			var names []string
+			for _, user := range users {
+				names = append(names, user.kind+" "+user.name)
+				if user.deleting {
+					continue
+				}
+				if err := r.Delete(ctx, user.obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+					log.Error(err, "Failed to delete the resource using the Provider", "resource", user.kind+" "+user.name)
+					return ctrl.Result{}, err
+				}
+			}
+
+			// The resources are owned by the provider, it's reconciled again
+			// when they're gone
+			log.Info("Waiting for the resources using the Provider to be deleted", "resources", names)
+			setDeletionBlocked(&provider.Status.CommonStatus, provider.Generation, names)
+			if err := r.Status().Update(ctx, provider); err != nil {
+				log.Error(err, "Failed to update Provider Status")
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, nil
+		}
+
+		controllerutil.RemoveFinalizer(provider, terraformv1alpha1.ProviderFinalizer)
+		if err := r.Update(ctx, provider); err != nil {
+			log.Error(err, "Failed to remove the finalizer of Provider")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(provider, terraformv1alpha1.ProviderFinalizer) {
+		controllerutil.AddFinalizer(provider, terraformv1alpha1.ProviderFinalizer)
+		if err := r.Update(ctx, provider); err != nil {
+			log.Error(err, "Failed to add the finalizer of Provider")
+			return ctrl.Result{}, err
+		}
+		// Finalizer added - return and requeue
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// Move the deprecated inline credentials into a Secret labeled with the Provider
+	if util.HasInlineCredentials(provider) {
+		if err = r.migrateCredentials(ctx, provider); err != nil {
+			log.Error(err, "Failed to migrate the inline credentials")
+			setFailed(&provider.Status.CommonStatus, provider.Generation, ReasonCredentialsMigrationFailed, err)
+			if err := r.Status().Update(ctx, provider); err != nil {
+				log.Error(err, "Failed to update Provider Status")
+			}
+			return ctrl.Result{}, err
+		}
+	}
 
 	// Create Terraform Working Directory
 	//terraDir := util.HCL_DIR + "/" + providerName
 
+	setSynced(&provider.Status.CommonStatus, provider.Generation)
+	setCondition(&provider.Status.CommonStatus, provider.Generation, terraformv1alpha1.ConditionReady, metav1.ConditionTrue, ReasonReconciled, "")
+	if err = r.Status().Update(ctx, provider); err != nil {
+		log.Error(err, "Failed to update Provider Status")
+		return ctrl.Result{}, err
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// migrateCredentials moves the inline credentials of the provider into a Secret
+// and references it from credentialsSecretRef. An existing reference is kept,
+// the inline credentials are just removed.
+func (r *ProviderReconciler) migrateCredentials(ctx context.Context, provider *terraformv1alpha1.Provider) error {
+	message := "Inline credentials (spec.aws, spec.azure) are deprecated, use spec.credentialsSecretRef"
+
+	if provider.Spec.CredentialsSecretRef == nil {
+		// The Secret isn't owned by the provider, it must outlive it if the
+		// resources using the provider are destroyed after it
+		secret := util.CredentialsSecretForProvider(provider)
+		secret.Labels = labelsForProvider(provider.Name)
+		if err := r.Create(ctx, secret); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return err
+			}
+			// Left by a previous migration which failed to update the Provider
+			existing := &corev1.Secret{}
+			if err := r.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, existing); err != nil {
+				return err
+			}
+			// Older versions made the provider its controller instead of labeling it
+			if existing.Labels["provider_cr"] != provider.Name && !metav1.IsControlledBy(existing, provider) {
+				return fmt.Errorf("failed to move the inline credentials, Secret %s already exists", secret.Name)
+			}
+		}
+
+		provider.Spec.CredentialsSecretRef = &terraformv1alpha1.CredentialsSecretRef{Name: secret.Name}
+		message += fmt.Sprintf(". They have been moved into Secret %s", secret.Name)
+	}
+
+	provider.Spec.AWS = terraformv1alpha1.AWSSpec{}
+	provider.Spec.Azure = terraformv1alpha1.AzureSpec{}
+	if err := r.Update(ctx, provider); err != nil {
+		return err
+	}
+
+	r.Log.Info("DEPRECATED: "+message, "provider", provider.Name, "namespace", provider.Namespace)
+	r.Recorder.Event(provider, corev1.EventTypeWarning, "DeprecatedCredentials", message)
+	return nil
+}
+
+// providerUsers are the kinds of the resources using a provider, they're
+// owned by it
+var providerUsers = []struct {
+	kind      string
+	obj, list runtime.Object
+}{
+	{"AWSVPC", &terraformv1alpha1.AWSVPC{}, &terraformv1alpha1.AWSVPCList{}},
+	{"AWSSubnet", &terraformv1alpha1.AWSSubnet{}, &terraformv1alpha1.AWSSubnetList{}},
+	{"AWSGateway", &terraformv1alpha1.AWSGateway{}, &terraformv1alpha1.AWSGatewayList{}},
+	{"AWSRoute", &terraformv1alpha1.AWSRoute{}, &terraformv1alpha1.AWSRouteList{}},
+	{"AWSSecurityGroup", &terraformv1alpha1.AWSSecurityGroup{}, &terraformv1alpha1.AWSSecurityGroupList{}},
+	{"AWSSecurityGroupRule", &terraformv1alpha1.AWSSecurityGroupRule{}, &terraformv1alpha1.AWSSecurityGroupRuleList{}},
+	{"AWSKey", &terraformv1alpha1.AWSKey{}, &terraformv1alpha1.AWSKeyList{}},
+	{"AWSInstance", &terraformv1alpha1.AWSInstance{}, &terraformv1alpha1.AWSInstanceList{}},
+	{"Network", &terraformv1alpha1.Network{}, &terraformv1alpha1.NetworkList{}},
+	{"Instance", &terraformv1alpha1.Instance{}, &terraformv1alpha1.InstanceList{}},
+	{"HCL", &terraformv1alpha1.HCL{}, &terraformv1alpha1.HCLList{}},
+	{"Repository", &terraformv1alpha1.Repository{}, &terraformv1alpha1.RepositoryList{}},
+}
+
+// providerUser is a resource using a provider
+type providerUser struct {
+	kind, name string
+	obj        runtime.Object
+	// deleting is true if the resource is already being deleted
+	deleting bool
+}
+
+// users returns the resources using the provider
+func (r *ProviderReconciler) users(ctx context.Context, provider *terraformv1alpha1.Provider) ([]providerUser, error) {
+	var users []providerUser
+	for _, pu := range providerUsers {
+		list := pu.list.DeepCopyObject()
+		if err := r.List(ctx, list, client.InNamespace(provider.Namespace)); err != nil {
+			return nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			m, err := meta.Accessor(item)
+			if err != nil {
+				return nil, err
+			}
+			if metav1.IsControlledBy(m, provider) {
+				users = append(users, providerUser{kind: pu.kind, name: m.GetName(), obj: item, deleting: m.GetDeletionTimestamp() != nil})
+			}
+		}
+	}
+	return users, nil
+}
+
 // labelsForProvider returns the labels for selecting the resources
 // belonging to the given Provider CR name.
 func labelsForProvider(name string) map[string]string {
@@ -108,8 +263,11 @@ func labelsForProvider(name string) map[string]string {
 }
 
 func (r *ProviderReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	blder := ctrl.NewControllerManagedBy(mgr).
 		For(&terraformv1alpha1.Provider{}).
-		Owns(&appsv1.Deployment{}).
-		Complete(r)
+		Owns(&appsv1.Deployment{})
+	for _, pu := range providerUsers {
+		blder = blder.Owns(pu.obj)
+	}
+	return blder.Complete(r)
 }
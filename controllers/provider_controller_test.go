@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+)
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	s := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := terraformv1alpha1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestProviderBackgroundDeletion(t *testing.T) {
+	// The Provider is deleted in the background: the garbage collector waits
+	// for it to be gone before deleting the HCL it owns
+	now := metav1.Now()
+	provider := &terraformv1alpha1.Provider{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "aws",
+			Namespace:         "default",
+			UID:               "provider",
+			DeletionTimestamp: &now,
+			Finalizers:        []string{terraformv1alpha1.ProviderFinalizer},
+		},
+	}
+	controller := true
+	hcl := &terraformv1alpha1.HCL{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "code",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: terraformv1alpha1.GroupVersion.String(),
+				Kind:       "Provider",
+				Name:       provider.Name,
+				UID:        provider.UID,
+				Controller: &controller,
+			}},
+		},
+	}
+	scheme := newTestScheme(t)
+	c := fake.NewFakeClientWithScheme(scheme, provider, hcl)
+
+	r := &ProviderReconciler{Client: c, Log: ctrl.Log.WithName("test"), Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: provider.Namespace, Name: provider.Name}}
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	provider = &terraformv1alpha1.Provider{}
+	if err := c.Get(context.TODO(), req.NamespacedName, provider); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.Finalizers) == 0 {
+		t.Fatalf("Reconcile() removed the finalizer while the HCL uses the Provider")
+	}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: hcl.Namespace, Name: hcl.Name}, &terraformv1alpha1.HCL{}); !errors.IsNotFound(err) {
+		t.Fatalf("Reconcile() did not delete the HCL using the Provider, error = %v", err)
+	}
+
+	// The Provider is released once the HCL is gone
+	if _, err := r.Reconcile(req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	provider = &terraformv1alpha1.Provider{}
+	if err := c.Get(context.TODO(), req.NamespacedName, provider); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.Finalizers) != 0 {
+		t.Errorf("Reconcile() kept the finalizers %v once the HCL is gone", provider.Finalizers)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+)
+
+// Fields indexing the names of the referenced resources
+const (
+	vpcRefField            = ".spec.vpcRef"
+	subnetRefField         = ".spec.subnetRef"
+	gatewayRefField        = ".spec.gatewayRef"
+	securityGroupRefsField = ".spec.securityGroupRefs"
+	networkField           = ".spec.network"
+	userDataFromField      = ".spec.userDataFrom"
+)
+
+// referenceTarget is a resource which can be referenced by other resources
+type referenceTarget interface {
+	runtime.Object
+
+	// GetID returns the ID of the provisioned cloud resource
+	GetID() string
+
+	// GetCommonStatus returns the common status of the resource
+	GetCommonStatus() *terraformv1alpha1.CommonStatus
+}
+
+// reference is a reference of a resource to another resource, whose ID is
+// required to provision the resource
+type reference struct {
+	// field of the spec holding the reference
+	field string
+
+	// name of the referenced resource, in the namespace of the resource.
+	// The reference is optional when it's empty.
+	name string
+
+	// target receives the referenced resource
+	target referenceTarget
+
+	// id is set to the ID of the referenced resource
+	id *string
+}
+
+// dependencyError lists the referenced resources which are not Ready
+type dependencyError struct {
+	waiting []string
+}
+
+func (e *dependencyError) Error() string {
+	return "waiting for " + strings.Join(e.waiting, ", ")
+}
+
+// isDependencyError returns true if the resource waits for its dependencies
+func isDependencyError(err error) bool {
+	_, ok := err.(*dependencyError)
+	return ok
+}
+
+// resolveReferences sets the IDs of the referenced resources. It returns a
+// dependencyError if some of them are missing or not Ready, in which case
+// the IDs known so far are still set, so the resource can be destroyed.
+func resolveReferences(ctx context.Context, c client.Client, namespace string, refs ...reference) error {
+	var waiting []string
+	for _, ref := range refs {
+		if ref.name == "" {
+			continue
+		}
+
+		err := c.Get(ctx, types.NamespacedName{Name: ref.name, Namespace: namespace}, ref.target)
+		if errors.IsNotFound(err) {
+			waiting = append(waiting, fmt.Sprintf("%s %s to be created", ref.field, ref.name))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		*ref.id = ref.target.GetID()
+		ready := findCondition(ref.target.GetCommonStatus(), terraformv1alpha1.ConditionReady)
+		if *ref.id == "" || ready == nil || ready.Status != metav1.ConditionTrue {
+			waiting = append(waiting, fmt.Sprintf("%s %s to be Ready", ref.field, ref.name))
+		}
+	}
+
+	if len(waiting) != 0 {
+		return &dependencyError{waiting: waiting}
+	}
+	return nil
+}
+
+// referenceTargets are empty objects of the kinds which can be referenced
+var referenceTargets = map[string]runtime.Object{
+	"AWSVPC":           &terraformv1alpha1.AWSVPC{},
+	"AWSSubnet":        &terraformv1alpha1.AWSSubnet{},
+	"AWSGateway":       &terraformv1alpha1.AWSGateway{},
+	"AWSSecurityGroup": &terraformv1alpha1.AWSSecurityGroup{},
+	"Network":          &terraformv1alpha1.Network{},
+}
+
+// watchReferences indexes the names of the resources referenced by the
+// resources of the kind, and reconciles them when a resource they reference
+// changes, e.g. its ID is set
+func watchReferences(mgr ctrl.Manager, blder *builder.Builder, kind string) error {
+	c := mgr.GetClient()
+	for parent, dks := range dependentKinds {
+		for _, dk := range dks {
+			if dk.kind != kind {
+				continue
+			}
+
+			names := dk.names
+			indexer := func(obj runtime.Object) []string {
+				var values []string
+				for _, name := range names(obj) {
+					if name != "" {
+						values = append(values, name)
+					}
+				}
+				return values
+			}
+			if err := mgr.GetFieldIndexer().IndexField(context.Background(), dk.obj, dk.field, indexer); err != nil {
+				return err
+			}
+
+			list, field := dk.list, dk.field
+			blder.Watches(&source.Kind{Type: referenceTargets[parent].DeepCopyObject()}, &handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+					dependents := list.DeepCopyObject()
+					err := c.List(context.Background(), dependents, client.InNamespace(o.Meta.GetNamespace()), client.MatchingFields{field: o.Meta.GetName()})
+					if err != nil {
+						return nil
+					}
+					items, err := meta.ExtractList(dependents)
+					if err != nil {
+						return nil
+					}
+
+					var requests []reconcile.Request
+					for _, item := range items {
+						if m, err := meta.Accessor(item); err == nil {
+							requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: m.GetName(), Namespace: m.GetNamespace()}})
+						}
+					}
+					return requests
+				}),
+			})
+		}
+	}
+	return nil
+}
@@ -17,41 +17,50 @@ limitations under the License.
 package controllers
 
 import (
-	"io/ioutil"
+	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
-	"k8s.io/apimachinery/pkg/api/errors"
-
-	"context"
-
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
-
-	"fmt"
-
-	"gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/config"
-	"gopkg.in/src-d/go-git.v4/plumbing"
-	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"github.com/tmax-cloud/terraform-operator/util"
 )
 
+// repositorySyncInterval is how often the ref of the repository is resolved
+const repositorySyncInterval = 60 * time.Second
+
 // RepositoryReconciler reconciles a Repository object
 type RepositoryReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// CacheDir is the directory where the repositories are cached between
+	// reconciles. Default: the working directory
+	CacheDir string
 }
 
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=repositories,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=repositories/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=terraform.tmax.io,resources=repositories/finalizers,verbs=update
 
+// Reconcile resolves the ref of the repository, and applies the code of its
+// path with the provider of its Provider when the commit changes
 func (r *RepositoryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("repository", req.NamespacedName)
@@ -72,7 +81,6 @@ func (r *RepositoryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{}, err
 	}
 
-	// your logic here
 	helper, _ := patch.NewHelper(repository, r.Client)
 
 	defer func() {
@@ -81,116 +89,284 @@ func (r *RepositoryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		}
 	}()
 
-	if repository.Spec.Type == "" {
-		repository.Spec.Type = "Public"
-	}
+	input := util.TerraVars{}
 
-	repositoryName := repository.Name
-	repositoryType := repository.Spec.Type
-	repositoryURL := repository.Spec.URL
-	repositoryBranch := repository.Spec.Branch
-	repositoryID := repository.Spec.ID
-	repositoryPW := repository.Spec.PW
+	input.Name = repository.Name
+	input.Namespace = repository.Namespace
+	input.UID = string(repository.UID)
+	input.Type = "Repository"
+	input.HCLVars = specVars(repository.Spec.Vars)
 
-	repositoryAuth := &http.BasicAuth{
-		Username: repositoryID,
-		Password: repositoryPW,
+	// Fetch the "Provider" instance related to "Repository" (Repository -> Provider)
+	provider := &terraformv1alpha1.Provider{}
+	err = r.Get(ctx, types.NamespacedName{Name: repository.Spec.Provider, Namespace: repository.Namespace}, provider)
+	if err != nil {
+		// Error reading the object - requeue the request.
+		log.Error(err, "Failed to get Provider")
+		setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonProviderNotFound, err)
+		return ctrl.Result{}, err
 	}
 
-	fmt.Println("repositoryName:" + repositoryName)
-	fmt.Println("repositoryType:" + repositoryType)
-	fmt.Println("repositoryURL:" + repositoryURL)
-	fmt.Println("repositoryBranch:" + repositoryBranch)
-	fmt.Println("repositoryID:" + repositoryID)
-	fmt.Println("repositoryPW:" + repositoryPW)
+	// The credentials are read from the Secret of the provider when Terraform is executed
+	input = util.ProviderVars(input, provider)
 
-	// Clone Repository
-	if repositoryType == "Public" {
-		_, err = git.PlainClone(repositoryName, false, &git.CloneOptions{
-			URL:      repositoryURL,
-			Progress: os.Stdout,
-		})
-	} else {
-		_, err = git.PlainClone(repositoryName, false, &git.CloneOptions{
-			Auth:     repositoryAuth,
-			URL:      repositoryURL,
-			Progress: os.Stdout,
-		})
+	// Set Provider as the owner and controller in Repository CR
+	if err = ctrl.SetControllerReference(provider, repository, r.Scheme); err != nil {
+		log.Error(err, "Failed to set ownerReferences")
+		return ctrl.Result{}, err
 	}
+
+	input.HCLRootModule, err = rootModule(repository.Spec.Path)
 	if err != nil {
-		log.Error(err, "Failed to clone Repository")
+		log.Error(err, "Invalid path")
+		setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonInvalidPath, err)
+		return ctrl.Result{}, err
+	}
+
+	// Move the deprecated inline credentials into a Secret owned by the Repository
+	if repository.Spec.ID != "" || repository.Spec.PW != "" {
+		if err = r.migrateCredentials(ctx, repository); err != nil {
+			log.Error(err, "Failed to migrate the inline credentials")
+			setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonCredentialsMigrationFailed, err)
+			return ctrl.Result{}, err
+		}
+	}
+
+	dir := r.repositoryDir(repository)
+
+	// Release the state lock requested by the force-unlock annotation, a
+	// stale lock would block the destroy too
+	util.ForceUnlockAnnotated(r.Client, input, repository, log)
+
+	// Destroy the provisioned resources before the repository is deleted
+	if !repository.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(repository, terraformv1alpha1.DestroyFinalizer) {
+			return ctrl.Result{}, nil
+		}
+
+		// Show the repository as deleting while Terraform is running
+		setDeleting(&repository.Status.CommonStatus, repository.Generation)
+		if err = helper.Patch(ctx, repository); err != nil {
+			log.Error(err, "repository patch error")
+			return ctrl.Result{}, err
+		}
+		helper, _ = patch.NewHelper(repository, r.Client)
+
+		if repository.Spec.GetDeletionPolicy(provider) == terraformv1alpha1.DeletionPolicyOrphan {
+			// Keep the remote resources, only their state is removed
+			ids, err := util.OrphanTerraform(r.Client, input)
+			if err != nil {
+				log.Error(err, "Terraform Orphan Error")
+				repository.Status.Phase = "error"
+				repository.Status.Lock = util.LockStatus(err)
+				setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonOrphanFailed, err)
+				return ctrl.Result{}, err
+			}
+			r.Recorder.Eventf(repository, corev1.EventTypeNormal, ReasonOrphaned, "Kept the cloud resources: %s", strings.Join(ids, ", "))
+		} else {
+			// Destroy with the code of the last applied commit, checked out
+			// from the cache when it's there. Without the code, e.g. nothing
+			// was applied or the repository was deleted, the resources of
+			// the state are destroyed with the providers only.
+			if repository.Status.LastAppliedCommit != "" {
+				input.HCLFiles, err = r.appliedCode(ctx, repository, dir, input.HCLRootModule)
+				if err != nil {
+					log.Error(err, "Failed to sync Repository, destroying the resources of the state without the code")
+				}
+			}
+			if len(input.HCLFiles) == 0 {
+				input.HCLFiles, input.HCLVars = nil, nil
+				input.HCLStateOnly = true
+			}
+
+			_, err = util.ExecuteTerraform(r.Client, input, true)
+			if err != nil {
+				log.Error(err, "Terraform Destroy Error")
+				repository.Status.Phase = "error"
+				repository.Status.Lock = util.LockStatus(err)
+				setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonDestroyFailed, err)
+				return ctrl.Result{}, err
+			}
+		}
+
+		if err = os.RemoveAll(dir); err != nil {
+			log.Error(err, "Failed to remove the cache of Repository")
+		}
+		controllerutil.RemoveFinalizer(repository, terraformv1alpha1.DestroyFinalizer)
+		return ctrl.Result{}, nil
+	}
+
+	// Add the finalizer before provisioning, so the resources are never left behind
+	if !controllerutil.ContainsFinalizer(repository, terraformv1alpha1.DestroyFinalizer) {
+		controllerutil.AddFinalizer(repository, terraformv1alpha1.DestroyFinalizer)
+		// Finalizer added - return and requeue
+		return ctrl.Result{Requeue: true}, nil
 	}
 
-	// Open Repository
-	gitrepo, err := git.PlainOpen(repositoryName)
+	auth, err := r.auth(ctx, repository)
 	if err != nil {
-		log.Error(err, "Failed to Open Repository")
+		log.Error(err, "Invalid credentials")
+		setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonInvalidCredentials, err)
+		return ctrl.Result{}, err
 	}
 
-	// Create Work Tree
-	worktree, err := gitrepo.Worktree()
+	// Resolve the ref every interval, its commit is only fetched when it's
+	// not in the cache
+	revision, err := util.SyncRepository(dir, repository.Spec.URL, repository.Spec.GetRef(), auth)
 	if err != nil {
-		log.Error(err, "Failed to Create WorkTree")
+		log.Error(err, "Failed to sync Repository")
+		repository.Status.Phase = "error"
+		setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonSyncFailed, err)
+		return ctrl.Result{}, err
+	}
+	now := metav1.Now()
+	commit := revision.Commit
+	repository.Status.Commit = commit
+	repository.Status.Tag = revision.Tag
+	repository.Status.LastSyncTime = &now
+
+	// The code is only planned and applied again when the commit or the spec
+	// changed, or the last apply failed
+	if commit == repository.Status.LastAppliedCommit && repository.Generation == repository.Status.LastAppliedGeneration {
+		setSynced(&repository.Status.CommonStatus, repository.Generation)
+		return ctrl.Result{RequeueAfter: repositorySyncInterval}, nil
 	}
 
-	// Get All Remote Branches
-	err = gitrepo.Fetch(&git.FetchOptions{
-		RefSpecs: []config.RefSpec{"refs/*:refs/*", "HEAD:refs/heads/HEAD"},
-	})
+	input.HCLFiles, err = util.ReadCode(dir, input.HCLRootModule)
 	if err != nil {
-		log.Error(err, "Failed to get all remote branches")
-	}
-	//fmt.Sprintf("refs/heads/%s", repositoryBranch),
-
-	// Checkout the selected branch
-	if repositoryBranch != "" {
-		branch := "refs/heads/" + repositoryBranch
-		err = worktree.Checkout(&git.CheckoutOptions{
-			Branch: plumbing.ReferenceName(branch),
-			Force:  true,
-		})
-		if err != nil {
-			log.Error(err, "Failed to checkout the branch")
-		}
+		log.Error(err, "Failed to read the code of Repository")
+		repository.Status.Phase = "error"
+		setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonSyncFailed, err)
+		return ctrl.Result{}, err
 	}
 
-	// Pull the Git Repository
-	if repositoryType == "Public" {
-		err = worktree.Pull(&git.PullOptions{RemoteName: "origin"})
-	} else {
-		err = worktree.Pull(&git.PullOptions{
-			Auth:       repositoryAuth,
-			RemoteName: "origin",
-		})
+	plan, err := util.PlanTerraform(r.Client, input)
+	repository.Status.Lock = util.LockStatus(err)
+	if repository.Status.Lock != nil {
+		// The state is locked by another operation, retry on the next reconcile
+		log.Info("Terraform state is locked", "LockID", repository.Status.Lock.ID, "Stale", repository.Status.Lock.Stale)
+		setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonPlanFailed, err)
+		return ctrl.Result{RequeueAfter: repositorySyncInterval}, nil
+	} else if err != nil {
+		repository.Status.Phase = "error"
+		setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonPlanFailed, err)
+		return ctrl.Result{RequeueAfter: repositorySyncInterval}, nil
 	}
-	if err != nil {
-		log.Error(err, "Failed to pull Repository")
+	log.Info("plan", "commit", commit, "add", plan.Add, "change", plan.Change, "destroy", plan.Destroy)
+	repository.Status.Plan = plan
+
+	_, err = util.ExecuteTerraform(r.Client, input, false)
+	repository.Status.Lock = util.LockStatus(err)
+	if repository.Status.Lock != nil {
+		// The state is locked by another operation, retry on the next reconcile
+		log.Info("Terraform state is locked", "LockID", repository.Status.Lock.ID, "Stale", repository.Status.Lock.Stale)
+		setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonApplyFailed, err)
+	} else if err != nil {
 		repository.Status.Phase = "error"
+		setFailed(&repository.Status.CommonStatus, repository.Generation, ReasonApplyFailed, err)
 	} else {
-		repository.Status.Phase = "success"
+		repository.Status.Phase = "provisioned"
+		repository.Status.LastAppliedCommit = commit
+		setApplied(&repository.Status.CommonStatus, repository.Generation)
+		r.Recorder.Eventf(repository, corev1.EventTypeNormal, ReasonProvisioned, "Applied commit %s", commit)
 	}
 
-	//targetDir := repositoryName
-	files, err := ioutil.ReadDir(repositoryName)
-	if err != nil {
-		fmt.Println(err)
+	return ctrl.Result{RequeueAfter: repositorySyncInterval}, nil // Reconcile loop rescheduled for the next sync
+}
+
+// rootModule returns the directory of the root module of the repository, it
+// must be in the repository
+func rootModule(path string) (string, error) {
+	root := filepath.Clean(path)
+	if filepath.IsAbs(root) || root == ".." || strings.HasPrefix(root, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is not a directory of the repository", path)
+	}
+	if root == "." {
+		return "", nil
 	}
-	for _, file := range files {
-		// 파일명
-		fmt.Println(file.Name())
-		// 파일의 절대경로
-		fmt.Println(fmt.Sprintf("%v/%v", repositoryName, file.Name()))
-		// 파일 내용
-		//fmt.Printf("%s", file)
-		content, _ := ioutil.ReadFile(fmt.Sprintf("%v/%v", repositoryName, file.Name()))
-		fmt.Printf("%s", content)
+	return root, nil
+}
+
+// repositoryDir returns the directory where the repository is cached
+func (r *RepositoryReconciler) repositoryDir(repository *terraformv1alpha1.Repository) string {
+	return filepath.Join(r.CacheDir, repository.Namespace, repository.Name)
+}
+
+// appliedCode returns the code of the last applied commit of the repository.
+// The commit is checked out from the cache if it's there, without connecting
+// to the repository nor reading its credentials.
+func (r *RepositoryReconciler) appliedCode(ctx context.Context, repository *terraformv1alpha1.Repository, dir, rootModule string) (map[string]string, error) {
+	auth, authErr := r.auth(ctx, repository)
+	if _, err := util.SyncRepository(dir, repository.Spec.URL, repository.Status.LastAppliedCommit, auth); err != nil {
+		if authErr != nil {
+			return nil, authErr
+		}
+		return nil, err
+	}
+	return util.ReadCode(dir, rootModule)
+}
+
+// auth returns the credentials of the repository, read from its
+// Secret
+func (r *RepositoryReconciler) auth(ctx context.Context, repository *terraformv1alpha1.Repository) (*util.GitCredentials, error) {
+	ref := repository.Spec.SecretRef
+	if ref == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: repository.Namespace}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get the credentials Secret %s. %s", ref.Name, err)
+	}
+	return util.GitAuth(repository.Spec.URL, secret)
+}
+
+// migrateCredentials moves the inline credentials of the repository into a
+// Secret and references it from secretRef. An existing reference is kept, the
+// inline credentials are just removed.
+func (r *RepositoryReconciler) migrateCredentials(ctx context.Context, repository *terraformv1alpha1.Repository) error {
+	message := "Inline credentials (spec.id, spec.pw) are deprecated, use spec.secretRef"
+
+	if repository.Spec.SecretRef == nil {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      repository.Name + "-git-credentials",
+				Namespace: repository.Namespace,
+			},
+			Type: corev1.SecretTypeBasicAuth,
+			StringData: map[string]string{
+				util.GitUsernameKey: repository.Spec.ID,
+				util.GitPasswordKey: repository.Spec.PW,
+			},
+		}
+		if err := ctrl.SetControllerReference(repository, secret, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return err
+			}
+			// Left by a previous migration which failed to update the Repository
+			existing := &corev1.Secret{}
+			if err := r.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, existing); err != nil {
+				return err
+			}
+			if !metav1.IsControlledBy(existing, repository) {
+				return fmt.Errorf("failed to move the inline credentials, Secret %s already exists", secret.Name)
+			}
+		}
+
+		repository.Spec.SecretRef = &terraformv1alpha1.RepositorySecretReference{Name: secret.Name}
+		message += fmt.Sprintf(". They have been moved into Secret %s", secret.Name)
 	}
 
-	// Create Terraform Working Directory
-	//terraDir := util.HCL_DIR + "/" + providerName
+	repository.Spec.Type = ""
+	repository.Spec.ID = ""
+	repository.Spec.PW = ""
 
-	return ctrl.Result{RequeueAfter: time.Second * 60}, nil // Reconcile loop rescheduled after 60 seconds
-	//return ctrl.Result{}, nil
+	r.Log.Info("DEPRECATED: "+message, "repository", repository.Name, "namespace", repository.Namespace)
+	r.Recorder.Event(repository, corev1.EventTypeWarning, "DeprecatedCredentials", message)
+	return nil
 }
 
 func (r *RepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -0,0 +1,265 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+	"github.com/tmax-cloud/terraform-operator/util"
+)
+
+// Reasons of the conditions
+const (
+	ReasonProvisioned   = "Provisioned"
+	ReasonReconciled    = "Reconciled"
+	ReasonUpToDate      = "UpToDate"
+	ReasonChanged       = "Changed"
+	ReasonMissing       = "Missing"
+	ReasonDriftIgnored  = "DriftIgnored"
+	ReasonDestroying    = "Destroying"
+	ReasonApplyFailed   = "ApplyFailed"
+	ReasonPlanFailed    = "PlanFailed"
+	ReasonDestroyFailed = "DestroyFailed"
+	ReasonStateLocked   = "StateLocked"
+	ReasonOrphanFailed  = "OrphanFailed"
+	ReasonOrphaned      = "Orphaned"
+	ReasonImported      = "Imported"
+	ReasonImportFailed  = "ImportFailed"
+	ReasonImportDiff    = "ImportDiff"
+
+	ReasonConnectionSecretFailed = "ConnectionSecretFailed"
+	ReasonInvalidKey             = "InvalidKey"
+	ReasonInvalidRule            = "InvalidRule"
+	ReasonInvalidInstance        = "InvalidInstance"
+	ReasonDependencyNotReady     = "DependencyNotReady"
+	ReasonDependenciesReady      = "DependenciesReady"
+	ReasonDependentsExist        = "DependentsExist"
+	ReasonInvalidNetwork         = "InvalidNetwork"
+	ReasonComponentsFailed       = "ComponentsFailed"
+	ReasonComponentsNotReady     = "ComponentsNotReady"
+	ReasonComponentsReady        = "ComponentsReady"
+	ReasonInvalidVars            = "InvalidVars"
+	ReasonPaused                 = "Paused"
+	ReasonInvalidPath            = "InvalidPath"
+	ReasonSyncFailed             = "SyncFailed"
+	ReasonInvalidCredentials     = "InvalidCredentials"
+
+	ReasonProviderNotFound           = "ProviderNotFound"
+	ReasonCredentialsMigrationFailed = "CredentialsMigrationFailed"
+)
+
+// setCondition adds or updates the condition of the given type. The transition
+// time only changes when the status of the condition changes.
+func setCondition(status *terraformv1alpha1.CommonStatus, generation int64, conditionType string, conditionStatus metav1.ConditionStatus, reason, message string) {
+	condition := terraformv1alpha1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: generation,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+
+	for i := range status.Conditions {
+		if status.Conditions[i].Type != conditionType {
+			continue
+		}
+		if status.Conditions[i].Status == conditionStatus {
+			condition.LastTransitionTime = status.Conditions[i].LastTransitionTime
+		}
+		status.Conditions[i] = condition
+		return
+	}
+	status.Conditions = append(status.Conditions, condition)
+}
+
+// findCondition returns the condition of the given type, or nil if it's not set
+func findCondition(status *terraformv1alpha1.CommonStatus, conditionType string) *terraformv1alpha1.Condition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setApplied records a successful apply of the cloud resources
+func setApplied(status *terraformv1alpha1.CommonStatus, generation int64) {
+	now := metav1.Now()
+	status.LastAppliedTime = &now
+	status.LastAppliedGeneration = generation
+
+	setSynced(status, generation)
+	setCondition(status, generation, terraformv1alpha1.ConditionReady, metav1.ConditionTrue, ReasonProvisioned, "")
+	setCondition(status, generation, terraformv1alpha1.ConditionDrifted, metav1.ConditionFalse, ReasonUpToDate, "")
+}
+
+// setImported records the import of an existing cloud resource. The spec is
+// considered applied, the differences are found by the next plan.
+func setImported(status *terraformv1alpha1.CommonStatus, generation int64) {
+	status.LastAppliedGeneration = generation
+
+	setSynced(status, generation)
+	setCondition(status, generation, terraformv1alpha1.ConditionReady, metav1.ConditionTrue, ReasonImported, "")
+}
+
+// setPlanned records the drift found by the plan, according to the drift
+// policy. It returns true if the drift has to be reconciled.
+func setPlanned(status *terraformv1alpha1.CommonStatus, generation int64, policy terraformv1alpha1.DriftPolicy, plan *terraformv1alpha1.PlanStatus) bool {
+	status.Plan = plan
+	setSynced(status, generation)
+
+	if len(plan.Resources) == 0 {
+		setCondition(status, generation, terraformv1alpha1.ConditionDrifted, metav1.ConditionFalse, ReasonUpToDate, "")
+		return false
+	}
+
+	reason := ReasonChanged
+	var changes []string
+	for _, r := range plan.Resources {
+		if r.Action == terraformv1alpha1.ActionCreate {
+			reason = ReasonMissing
+		}
+		changes = append(changes, r.Address+": "+r.Action)
+	}
+	message := "The cloud resources drifted from the spec: " + strings.Join(changes, ", ")
+
+	switch policy {
+	case terraformv1alpha1.DriftPolicyIgnore:
+		setCondition(status, generation, terraformv1alpha1.ConditionDrifted, metav1.ConditionUnknown, ReasonDriftIgnored, message)
+		return false
+	case terraformv1alpha1.DriftPolicyReport:
+		if importPending(status) {
+			reason = ReasonImportDiff
+			message = fmt.Sprintf("The imported cloud resources differ from the spec: %s. Annotate the resource with %s=true to apply the spec",
+				strings.Join(changes, ", "), terraformv1alpha1.ApplyImportAnnotation)
+		}
+		setCondition(status, generation, terraformv1alpha1.ConditionDrifted, metav1.ConditionTrue, reason, message)
+		return false
+	}
+	setCondition(status, generation, terraformv1alpha1.ConditionDrifted, metav1.ConditionTrue, reason, message)
+	return true
+}
+
+// importPending returns whether the cloud resources were imported and the spec
+// has not been applied to them yet
+func importPending(status *terraformv1alpha1.CommonStatus) bool {
+	ready := findCondition(status, terraformv1alpha1.ConditionReady)
+	return ready != nil && ready.Reason == ReasonImported
+}
+
+// driftPolicy returns the drift policy of the resource. The differences of
+// imported cloud resources from the spec are only reported, until the user
+// acknowledges them with the apply-import annotation or sets the drift policy
+// to Reconcile explicitly.
+func driftPolicy(status *terraformv1alpha1.CommonStatus, spec *terraformv1alpha1.CommonSpec, obj metav1.Object) terraformv1alpha1.DriftPolicy {
+	if !importPending(status) || spec.DriftPolicy == terraformv1alpha1.DriftPolicyReconcile || obj.GetAnnotations()[terraformv1alpha1.ApplyImportAnnotation] == "true" {
+		return spec.GetDriftPolicy()
+	}
+	if spec.DriftPolicy == terraformv1alpha1.DriftPolicyIgnore {
+		return spec.DriftPolicy
+	}
+	return terraformv1alpha1.DriftPolicyReport
+}
+
+// nextDriftCheck returns how long to wait for the next drift check, or 0 if
+// it's due. The drift is checked by a plan, and right after an apply.
+func nextDriftCheck(status *terraformv1alpha1.CommonStatus, interval time.Duration) time.Duration {
+	var last time.Time
+	if status.Plan != nil {
+		last = status.Plan.Time.Time
+	}
+	if status.LastAppliedTime != nil && status.LastAppliedTime.After(last) {
+		last = status.LastAppliedTime.Time
+	}
+
+	if wait := time.Until(last.Add(interval)); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// setSynced records a successful reconcile
+func setSynced(status *terraformv1alpha1.CommonStatus, generation int64) {
+	status.ObservedGeneration = generation
+	status.FailureReason = ""
+	status.FailureMessage = ""
+
+	setCondition(status, generation, terraformv1alpha1.ConditionSynced, metav1.ConditionTrue, ReasonReconciled, "")
+}
+
+// setDeleting records that the cloud resources are being destroyed
+func setDeleting(status *terraformv1alpha1.CommonStatus, generation int64) {
+	setCondition(status, generation, terraformv1alpha1.ConditionDeleting, metav1.ConditionTrue, ReasonDestroying, "")
+	setCondition(status, generation, terraformv1alpha1.ConditionReady, metav1.ConditionFalse, ReasonDestroying, "")
+}
+
+// setWaiting records that the resource waits for the referenced resources to
+// be Ready. Ready is only changed if the cloud resources have not been
+// provisioned yet.
+func setWaiting(status *terraformv1alpha1.CommonStatus, generation int64, err error) {
+	status.ObservedGeneration = generation
+
+	setCondition(status, generation, terraformv1alpha1.ConditionWaitingForDependency, metav1.ConditionTrue, ReasonDependencyNotReady, err.Error())
+	if ready := findCondition(status, terraformv1alpha1.ConditionReady); ready == nil || ready.Status != metav1.ConditionTrue {
+		setCondition(status, generation, terraformv1alpha1.ConditionReady, metav1.ConditionFalse, ReasonDependencyNotReady, err.Error())
+	}
+}
+
+// setDependenciesReady records that the referenced resources are Ready, once
+// the resource waited for them
+func setDependenciesReady(status *terraformv1alpha1.CommonStatus, generation int64) {
+	if findCondition(status, terraformv1alpha1.ConditionWaitingForDependency) != nil {
+		setCondition(status, generation, terraformv1alpha1.ConditionWaitingForDependency, metav1.ConditionFalse, ReasonDependenciesReady, "")
+	}
+}
+
+// setDeletionBlocked records that the cloud resources are only destroyed
+// once the resources referencing them are deleted
+func setDeletionBlocked(status *terraformv1alpha1.CommonStatus, generation int64, dependents []string) {
+	setCondition(status, generation, terraformv1alpha1.ConditionDeleting, metav1.ConditionTrue, ReasonDependentsExist, dependentsMessage(dependents))
+}
+
+// setPaused records that the cloud resources are left as they are, neither
+// applied nor checked for drift
+func setPaused(status *terraformv1alpha1.CommonStatus, generation int64) {
+	status.ObservedGeneration = generation
+	setCondition(status, generation, terraformv1alpha1.ConditionSynced, metav1.ConditionFalse, ReasonPaused, "the reconcile is paused, enabled is false")
+}
+
+// setFailed records the failure of the reconcile. The reason is StateLocked if
+// the Terraform state is locked by another operation. Ready is only changed
+// if the cloud resources have not been provisioned yet.
+func setFailed(status *terraformv1alpha1.CommonStatus, generation int64, reason string, err error) {
+	if util.LockStatus(err) != nil {
+		reason = ReasonStateLocked
+	}
+
+	status.ObservedGeneration = generation
+	status.FailureReason = reason
+	status.FailureMessage = err.Error()
+
+	setCondition(status, generation, terraformv1alpha1.ConditionSynced, metav1.ConditionFalse, reason, err.Error())
+	if ready := findCondition(status, terraformv1alpha1.ConditionReady); ready == nil || ready.Status != metav1.ConditionTrue {
+		setCondition(status, generation, terraformv1alpha1.ConditionReady, metav1.ConditionFalse, reason, err.Error())
+	}
+}
@@ -5,6 +5,8 @@ go 1.13
 require (
 	github.com/Azure/azure-sdk-for-go v36.2.0+incompatible
 	github.com/go-logr/logr v0.1.0
+	github.com/hashicorp/go-version v1.2.0
+	github.com/hashicorp/hcl/v2 v2.3.0
 	github.com/hashicorp/terraform v0.12.20
 	github.com/jen20/awspolicyequivalence v1.1.0 // indirect
 	github.com/onsi/ginkgo v1.12.1
@@ -15,8 +17,10 @@ require (
 	github.com/terraform-providers/terraform-provider-null v1.0.0
 	github.com/terraform-providers/terraform-provider-tls v2.1.0+incompatible
 	github.com/zclconf/go-cty v1.7.1
+	golang.org/x/crypto v0.0.0-20200220183623-bac4c82f6975
 	gopkg.in/src-d/go-git.v4 v4.13.1
 	k8s.io/api v0.18.6
+	k8s.io/apiextensions-apiserver v0.18.6
 	k8s.io/apimachinery v0.18.6
 	k8s.io/client-go v10.0.0+incompatible
 	sigs.k8s.io/cluster-api v0.3.8
@@ -0,0 +1,45 @@
+package terranova
+
+import (
+	"github.com/hashicorp/terraform/states/statemgr"
+)
+
+// LockInfo stores the metadata of a lock, it's an alias for statemgr.LockInfo
+type LockInfo = statemgr.LockInfo
+
+// Locker is the interface of the locks protecting the state of a Platform from
+// concurrent Terraform operations. It's similar to statemgr.Locker but it does
+// not depend on the state manager, so the state and the lock can be kept in
+// different places.
+type Locker interface {
+	// Lock acquires the lock for the operation described by info. It returns
+	// the ID of the lock, or an error immediately if it's held by someone else.
+	Lock(info *LockInfo) (string, error)
+
+	// Unlock releases the lock with the given ID.
+	Unlock(id string) error
+}
+
+// LockWith sets the lock acquired by Apply and Plan
+func (p *Platform) LockWith(l Locker) *Platform {
+	p.locker = l
+	return p
+}
+
+// lock acquires the lock, if there is one, for the given operation. It returns
+// the function to release it.
+func (p *Platform) lock(operation string) (func() error, error) {
+	if p.locker == nil {
+		return func() error { return nil }, nil
+	}
+
+	info := statemgr.NewLockInfo()
+	info.Operation = operation
+
+	id, err := p.locker.Lock(info)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error { return p.locker.Unlock(id) }, nil
+}
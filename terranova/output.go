@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/states"
+	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/json"
 )
 
@@ -27,6 +29,44 @@ func (p *Platform) OutputValueAsString(name string) (string, error) {
 	return valueAsString(output[name])
 }
 
+// Outputs returns the values of the Terraform outputs of the root module
+func (p *Platform) Outputs() map[string]cty.Value {
+	outputs := map[string]cty.Value{}
+	if p.State == nil || p.State.RootModule() == nil {
+		return outputs
+	}
+
+	for name, output := range p.State.RootModule().OutputValues {
+		outputs[name] = output.Value
+	}
+	return outputs
+}
+
+// ResourceAttributes returns the attributes of the resource instance at the
+// address `addr` in the state, e.g. `aws_vpc.main`, as an object value. The
+// types of the attributes are the ones found in the state.
+func (p *Platform) ResourceAttributes(addr string) (cty.Value, error) {
+	target, diags := addrs.ParseAbsResourceInstanceStr(addr)
+	if diags.HasErrors() {
+		return cty.NilVal, diags.Err()
+	}
+
+	if p.State == nil {
+		return cty.NilVal, fmt.Errorf("no state found")
+	}
+	instance := p.State.ResourceInstance(target)
+	if instance == nil || instance.Current == nil {
+		return cty.NilVal, fmt.Errorf("resource %q not found in the state", addr)
+	}
+
+	attrs := instance.Current.AttrsJSON
+	ty, err := json.ImpliedType(attrs)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return json.Unmarshal(attrs, ty)
+}
+
 // ValueAsString returns the given OutputValue as a string in JSON format.
 // Examples: `15`, `Hello`, ``, `true`, `["hello", true]`
 func valueAsString(v *states.OutputValue) (s string, err error) {
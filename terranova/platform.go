@@ -17,6 +17,7 @@ import (
 // Platform is the platform to be managed by Terraform
 type Platform struct {
 	Code          map[string]string
+	RootModule    string
 	Providers     map[addrs.Provider]providers.Factory
 	Provisioners  map[string]provisioners.Factory
 	Vars          map[string]interface{}
@@ -24,6 +25,8 @@ type Platform struct {
 	Hooks         []terraform.Hook
 	LogMiddleware *logger.Middleware
 	stateMgr      statemgr.Writer
+	locker        Locker
+	checkFile     func(path, content string) error
 	countHook     *local.CountHook
 	ExpectedStats *Stats
 	mu            sync.Mutex
@@ -81,6 +84,22 @@ func (p *Platform) AddFile(filename, code string) *Platform {
 	return p
 }
 
+// SetRootModule sets the directory of the code holding the root module, the
+// other directories may hold the local modules it calls. Use os.PathSeparator
+// as path separator.
+func (p *Platform) SetRootModule(dir string) *Platform {
+	p.RootModule = dir
+	return p
+}
+
+// CheckFilesWith sets the check of the files of the modules loaded from the
+// code, it returns an error for a file which must not be applied. The paths
+// are relative to the directory of the code.
+func (p *Platform) CheckFilesWith(check func(path, content string) error) *Platform {
+	p.checkFile = check
+	return p
+}
+
 // BindVars binds the map of variables to the Platform variables, to be used
 // by Terraform
 func (p *Platform) BindVars(vars map[string]interface{}) *Platform {
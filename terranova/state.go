@@ -75,3 +75,61 @@ func (p *Platform) PersistStateToFile(filename string) (*Platform, error) {
 
 	return p, nil
 }
+
+// PersistStateTo reads the state from the given state manager, if it has one.
+// Then the current state will be written to the state manager every time it
+// changes during the Terraform actions, and persisted once they are done.
+func (p *Platform) PersistStateTo(mgr statemgr.Storage) (*Platform, error) {
+	if err := mgr.RefreshState(); err != nil {
+		return p, err
+	}
+
+	p.mu.Lock()
+	if state := mgr.State(); state != nil {
+		p.State = state
+	}
+	p.mu.Unlock()
+
+	p.stateMgr = mgr
+
+	return p, nil
+}
+
+// refreshState reloads the state from the state manager, if it can be refreshed.
+// It's called once the lock is acquired, the state may have been changed by the
+// previous holder.
+func (p *Platform) refreshState() error {
+	mgr, ok := p.stateMgr.(statemgr.Storage)
+	if !ok {
+		return nil
+	}
+
+	if err := mgr.RefreshState(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if state := mgr.State(); state != nil {
+		p.State = state
+	}
+
+	return nil
+}
+
+// persistState writes the current state to the state manager, if there is one,
+// and persists it when the state manager supports it.
+func (p *Platform) persistState() error {
+	if p.stateMgr == nil {
+		return nil
+	}
+
+	if err := p.stateMgr.WriteState(p.State); err != nil {
+		return err
+	}
+	if persister, ok := p.stateMgr.(statemgr.Persister); ok {
+		return persister.PersistState()
+	}
+
+	return nil
+}
@@ -67,6 +67,11 @@ func (s *Stats) FromCountHook(countHook *local.CountHook) *Stats {
 	return s
 }
 
+// HasChanges returns true if there is something to add, change or destroy
+func (s *Stats) HasChanges() bool {
+	return s.Add+s.Change+s.Destroy > 0
+}
+
 func (s *Stats) String() string {
 	if s.fromPlan {
 		return fmt.Sprintf("resources: %d to add, %d to change, %d to destroy", s.Add, s.Change, s.Destroy)
@@ -1,28 +1,49 @@
 package terranova
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/backend/local"
 	"github.com/hashicorp/terraform/configs"
-	"github.com/hashicorp/terraform/configs/configload"
 	"github.com/hashicorp/terraform/plans"
 	"github.com/hashicorp/terraform/providers"
 	"github.com/hashicorp/terraform/terraform"
-	"github.com/zclconf/go-cty/cty"
+	"github.com/hashicorp/terraform/tfdiags"
 )
 
 // Apply brings the platform to the desired state. It'll destroy the platform
 // when `destroy` is `true`.
-func (p *Platform) Apply(destroy bool) error {
+func (p *Platform) Apply(destroy bool) (err error) {
 	p.startMiddleware()
 
+	operation := "apply"
+	if destroy {
+		operation = "destroy"
+	}
+	unlock, err := p.lock(operation)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uErr := unlock(); uErr != nil && err == nil {
+			err = uErr
+		}
+	}()
+
+	if err := p.refreshState(); err != nil {
+		return err
+	}
+
 	p.countHook = new(local.CountHook)
 	stateHook := new(local.StateHook)
 
@@ -54,17 +75,34 @@ func (p *Platform) Apply(destroy bool) error {
 	p.State = sts
 	// p.State = ctx.State()
 
+	// Persist the state even if the apply failed, it may be partially applied
+	err = p.persistState()
+
 	if diag.HasErrors() {
 		return diag.Err()
 	}
-	return nil
+	return err
 }
 
 // Plan returns execution plan for an existing configuration to apply to the
 // platform.
-func (p *Platform) Plan(destroy bool) (*plans.Plan, error) {
+func (p *Platform) Plan(destroy bool) (plan *plans.Plan, err error) {
 	p.startMiddleware()
 
+	unlock, err := p.lock("plan")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if uErr := unlock(); uErr != nil && err == nil {
+			err = uErr
+		}
+	}()
+
+	if err := p.refreshState(); err != nil {
+		return nil, err
+	}
+
 	ctx, err := p.newContext(destroy)
 	if err != nil {
 		return nil, err
@@ -82,6 +120,57 @@ func (p *Platform) Plan(destroy bool) (*plans.Plan, error) {
 	return plan, nil
 }
 
+// Import brings the existing remote resource with the given ID under the
+// management of the resource at the address `addr` of the code, e.g.
+// `aws_vpc.main`. The resource is read by the ImportResourceState of its
+// provider. Nothing is imported if the address is already in the state.
+func (p *Platform) Import(addr, id string) (err error) {
+	p.startMiddleware()
+
+	target, diags := addrs.ParseAbsResourceInstanceStr(addr)
+	if diags.HasErrors() {
+		return diags.Err()
+	}
+
+	unlock, err := p.lock("import")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uErr := unlock(); uErr != nil && err == nil {
+			err = uErr
+		}
+	}()
+
+	if err := p.refreshState(); err != nil {
+		return err
+	}
+	if p.State != nil && p.State.ResourceInstance(target) != nil {
+		return nil
+	}
+
+	ctx, err := p.newContext(false)
+	if err != nil {
+		return err
+	}
+
+	sts, diag := ctx.Import(&terraform.ImportOpts{
+		Targets: []*terraform.ImportTarget{
+			{
+				Addr:         target,
+				ID:           id,
+				ProviderAddr: target.Resource.Resource.DefaultProviderConfig().Absolute(addrs.RootModuleInstance),
+			},
+		},
+	})
+	if diag.HasErrors() {
+		return diag.Err()
+	}
+	p.State = sts
+
+	return p.persistState()
+}
+
 // startMiddleware starts the Log Middleware to intercept the logs if it has not
 // been already started
 func (p *Platform) startMiddleware() {
@@ -149,14 +238,69 @@ func (p *Platform) config() (*configs.Config, error) {
 		return nil, err
 	}
 
-	loader, err := configload.NewLoader(&configload.Config{
-		ModulesDir: filepath.Join(cfgPath, "modules"),
-	})
+	return loadConfig(cfgPath, p.RootModule, p.checkFile)
+}
+
+// Validate checks the code can be loaded by Terraform
+func (p *Platform) Validate() error {
+	cfgPath, err := ioutil.TempDir("", ".terraform")
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer os.RemoveAll(cfgPath)
 
-	config, diags := loader.LoadConfig(cfgPath)
+	if err := p.saveCode(cfgPath); err != nil {
+		return err
+	}
+
+	_, err = loadConfig(cfgPath, p.RootModule, p.checkFile)
+	return err
+}
+
+// loadConfig loads the configuration of the root module saved in the
+// directory of the code. The modules it calls must be local modules, whose
+// source is a path to a directory of the code, as there's no "terraform init"
+// to install the other ones. The files of the loaded modules are checked by
+// check, if not nil.
+func loadConfig(codeDir, rootModule string, check func(path, content string) error) (*configs.Config, error) {
+	parser := configs.NewParser(nil)
+	loadModule := func(dir string) (*configs.Module, hcl.Diagnostics) {
+		if diags := checkModuleFiles(parser, codeDir, dir, check); diags.HasErrors() {
+			return nil, diags
+		}
+		return parser.LoadConfigDir(dir)
+	}
+
+	rootDir := filepath.Join(codeDir, rootModule)
+	if !isInDir(codeDir, rootDir) {
+		return nil, fmt.Errorf("root module %s is outside of the directory of the code", rootModule)
+	}
+	rootMod, diags := loadModule(rootDir)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to load the configuration. %s", diags.Error())
+	}
+
+	config, diags := configs.BuildConfig(rootMod, configs.ModuleWalkerFunc(func(req *configs.ModuleRequest) (*configs.Module, *version.Version, hcl.Diagnostics) {
+		if !isLocalSource(req.SourceAddr) {
+			return nil, nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported module source",
+				Detail:   fmt.Sprintf("Module %q has source %q, only local modules are supported, whose source starts with ./ or ../.", req.Name, req.SourceAddr),
+				Subject:  &req.SourceAddrRange,
+			}}
+		}
+		dir := filepath.Clean(filepath.Join(req.Parent.Module.SourceDir, req.SourceAddr))
+		if !isInDir(codeDir, dir) {
+			return nil, nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Module source outside of the code",
+				Detail:   fmt.Sprintf("Module %q has source %q, which is outside of the directory of the code.", req.Name, req.SourceAddr),
+				Subject:  &req.SourceAddrRange,
+			}}
+		}
+		mod, diags := loadModule(dir)
+		return mod, nil, diags
+	}))
 	if diags.HasErrors() {
 		return nil, fmt.Errorf("failed to load the configuration. %s", diags.Error())
 	}
@@ -164,8 +308,68 @@ func (p *Platform) config() (*configs.Config, error) {
 	return config, nil
 }
 
+// checkModuleFiles checks the files of the module in the directory with check,
+// by path relative to the directory of the code
+func checkModuleFiles(parser *configs.Parser, codeDir, dir string, check func(path, content string) error) hcl.Diagnostics {
+	if check == nil {
+		return nil
+	}
+	primary, override, diags := parser.ConfigDirFiles(dir)
+	if diags.HasErrors() {
+		return diags
+	}
+	for _, path := range append(primary, override...) {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return diags.Append(&hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Failed to read file", Detail: err.Error()})
+		}
+		rel, err := filepath.Rel(codeDir, path)
+		if err != nil {
+			return diags.Append(&hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Failed to read file", Detail: err.Error()})
+		}
+		if err := check(rel, string(content)); err != nil {
+			return diags.Append(&hcl.Diagnostic{Severity: hcl.DiagError, Summary: "Code not allowed", Detail: err.Error()})
+		}
+	}
+	return diags
+}
+
+// ModuleDirs returns the directories of the root module of the code in the
+// directory and of the local modules it calls, relative to the directory.
+// They hold all the files loaded to apply the code.
+func ModuleDirs(codeDir, rootModule string) ([]string, error) {
+	config, err := loadConfig(codeDir, rootModule, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var dirs []string
+	config.DeepEach(func(c *configs.Config) {
+		// The directories of the modules are in the directory of the code
+		if rel, err := filepath.Rel(codeDir, c.Module.SourceDir); err == nil && !seen[rel] {
+			seen[rel] = true
+			dirs = append(dirs, rel)
+		}
+	})
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// isInDir returns true if the path is the directory or is in it
+func isInDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isLocalSource returns true if the source of a module is a local path
+func isLocalSource(addr string) bool {
+	return strings.HasPrefix(addr, "./") || strings.HasPrefix(addr, "../")
+}
+
 // Export save all the code to the given directory. The directory must exists
-// and there should be code to export.
+// and there should be code to export. The variables are saved HCL-encoded in
+// the terraform.tfvars file, with the types declared in the code.
 func (p *Platform) Export(dir string) error {
 	if len(p.Code) == 0 {
 		return fmt.Errorf("no code to export")
@@ -179,26 +383,28 @@ func (p *Platform) Export(dir string) error {
 		return nil
 	}
 
-	tfvarsFile, err := os.Create(filepath.Join(dir, "terraform.tfvars"))
+	cfg, err := loadConfig(dir, p.RootModule, p.checkFile)
+	if err != nil {
+		return err
+	}
+	vars, err := p.variables(cfg.Module.Variables)
 	if err != nil {
 		return err
 	}
-	defer tfvarsFile.Close()
 
-	var totalErr string
-	w := bufio.NewWriter(tfvarsFile)
-	for name, value := range p.Vars {
-		_, err := w.WriteString(fmt.Sprintf("%s = \"%s\"\n", name, value))
-		if err != nil {
-			totalErr = fmt.Sprintf("%s\n\t%s", totalErr, err)
-		}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
 	}
-	if err := w.Flush(); err != nil {
-		totalErr = fmt.Sprintf("%s\n\t%s", totalErr, err)
+	sort.Strings(names)
+
+	tfvars := hclwrite.NewEmptyFile()
+	for _, name := range names {
+		tfvars.Body().SetAttributeValue(name, vars[name].Value)
 	}
 
-	if len(totalErr) != 0 {
-		return fmt.Errorf("Failed to create the terraform.tfvars file. Errors:%s", totalErr)
+	if err := ioutil.WriteFile(filepath.Join(dir, "terraform.tfvars"), tfvars.Bytes(), 0600); err != nil {
+		return fmt.Errorf("Failed to create the terraform.tfvars file. %s", err)
 	}
 
 	return nil
@@ -211,6 +417,9 @@ func (p *Platform) saveCode(cfgPath string) error {
 
 	for filename, content := range p.Code {
 		cfgFileName := filepath.Join(cfgPath, filename)
+		if rel, err := filepath.Rel(cfgPath, cfgFileName); err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("file %s of the code is outside of the directory of the code", filename)
+		}
 
 		cfgFileDir := filepath.Dir(cfgFileName)
 		if _, err := os.Stat(cfgFileDir); os.IsNotExist(err) {
@@ -230,20 +439,33 @@ func (p *Platform) saveCode(cfgPath string) error {
 	return nil
 }
 
+// variables returns the values of the variables, converted to the types
+// declared in the code
 func (p *Platform) variables(v map[string]*configs.Variable) (terraform.InputValues, error) {
 	iv := make(terraform.InputValues)
+	var diags tfdiags.Diagnostics
 	for name, value := range p.Vars {
-		if _, declared := v[name]; !declared {
+		decl, declared := v[name]
+		if !declared {
 			return iv, fmt.Errorf("variable %q is not declared in the code", name)
 		}
 
-		val := &terraform.InputValue{
-			Value:      cty.StringVal(fmt.Sprintf("%v", value)),
-			SourceType: terraform.ValueFromCaller,
+		val, err := variableValue(value, decl.Type)
+		if err != nil {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid value for input variable",
+				Detail:   fmt.Sprintf("The value of variable %q is not compatible with its type constraint %s: %s.", name, decl.Type.FriendlyName(), tfdiags.FormatError(err)),
+				Subject:  decl.DeclRange.Ptr(),
+			})
+			continue
 		}
 
-		iv[name] = val
+		iv[name] = &terraform.InputValue{
+			Value:      val,
+			SourceType: terraform.ValueFromCaller,
+		}
 	}
 
-	return iv, nil
+	return iv, diags.Err()
 }
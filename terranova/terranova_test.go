@@ -0,0 +1,107 @@
+package terranova
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLocalModules(t *testing.T) {
+	module := `
+variable "cidr" {}
+output "cidr" { value = var.cidr }
+`
+	// A module outside of the code, e.g. the code of another resource
+	outside, err := ioutil.TempDir("", "module")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := ioutil.WriteFile(filepath.Join(outside, "net.tf"), []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+	escape := strings.Repeat("../", 20) + strings.TrimPrefix(filepath.ToSlash(outside), "/")
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		root    string
+		wantErr string
+	}{
+		{"nested module", map[string]string{
+			"main.tf":            "module \"net\" {\n  source = \"./modules/net\"\n  cidr   = \"10.0.0.0/16\"\n}\n",
+			"modules/net/net.tf": module,
+		}, "", ""},
+		{"sibling module", map[string]string{
+			"stacks/app/main.tf": "module \"net\" {\n  source = \"../../modules/net\"\n  cidr   = \"10.0.0.0/16\"\n}\n",
+			"modules/net/net.tf": module,
+		}, "stacks/app", ""},
+		{"registry module", map[string]string{
+			"main.tf": `module "vpc" { source = "terraform-aws-modules/vpc/aws" }`,
+		}, "", "Unsupported module source"},
+		{"file outside", map[string]string{
+			"../main.tf": module,
+		}, "", "outside of the directory"},
+		{"module outside", map[string]string{
+			"main.tf": fmt.Sprintf("module \"net\" {\n  source = %q\n  cidr   = \"10.0.0.0/16\"\n}\n", escape),
+		}, "", "outside of the code"},
+		{"module not allowed", map[string]string{
+			"main.tf":            "module \"net\" {\n  source = \"./modules/net\"\n  cidr   = \"10.0.0.0/16\"\n}\n",
+			"modules/net/net.tf": module + `output "denied" { value = "denied" }`,
+		}, "", "modules/net/net.tf is denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			platform := NewPlatform("").SetRootModule(tt.root).CheckFilesWith(func(path, content string) error {
+				if strings.Contains(content, "denied") {
+					return fmt.Errorf("%s is denied", filepath.ToSlash(path))
+				}
+				return nil
+			})
+			for path, code := range tt.files {
+				platform.AddFile(path, code)
+			}
+			err := platform.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModuleDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Only the stack and the modules it calls are loaded
+	err = NewPlatform("").
+		AddFile("stacks/app/main.tf", `module "net" { source = "../../modules/net" }`).
+		AddFile("stacks/other/main.tf", `module "db" { source = "../../modules/db" }`).
+		AddFile("modules/net/net.tf", `module "subnet" { source = "./subnet" }`).
+		AddFile("modules/net/subnet/subnet.tf", `output "id" { value = "1" }`).
+		AddFile("modules/db/db.tf", `output "id" { value = "1" }`).
+		saveCode(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, err := ModuleDirs(dir, filepath.Join("stacks", "app"))
+	if err != nil {
+		t.Fatalf("ModuleDirs() error = %v", err)
+	}
+	want := []string{filepath.Join("modules", "net"), filepath.Join("modules", "net", "subnet"), filepath.Join("stacks", "app")}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("ModuleDirs() = %v, want %v", dirs, want)
+	}
+}
@@ -0,0 +1,35 @@
+package terranova
+
+import (
+	"encoding/json"
+
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// variableValue converts the Go value of a variable to the type declared in
+// the code. The value is encoded as JSON to find its type, so slices, maps,
+// structs and JSON values (e.g. json.RawMessage) can be used.
+func variableValue(value interface{}, ty cty.Type) (cty.Value, error) {
+	if ty == cty.NilType {
+		ty = cty.DynamicPseudoType
+	}
+
+	val, ok := value.(cty.Value)
+	if !ok {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		implied, err := ctyjson.ImpliedType(data)
+		if err != nil {
+			return cty.NilVal, err
+		}
+		if val, err = ctyjson.Unmarshal(data, implied); err != nil {
+			return cty.NilVal, err
+		}
+	}
+
+	return convert.Convert(val, ty)
+}
@@ -0,0 +1,86 @@
+package terranova
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestVariableValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		ty      cty.Type
+		want    cty.Value
+		wantErr bool
+	}{
+		{"string", "10.0.0.0/16", cty.DynamicPseudoType, cty.StringVal("10.0.0.0/16"), false},
+		{"number as string", 8080, cty.String, cty.StringVal("8080"), false},
+		{"string as number", "8080", cty.Number, cty.NumberIntVal(8080), false},
+		{"bool", true, cty.Bool, cty.True, false},
+		{"list", []string{"10.0.0.0/24", "10.0.1.0/24"}, cty.List(cty.String), cty.ListVal([]cty.Value{cty.StringVal("10.0.0.0/24"), cty.StringVal("10.0.1.0/24")}), false},
+		{"map", map[string]string{"Name": "vpc"}, cty.Map(cty.String), cty.MapVal(map[string]cty.Value{"Name": cty.StringVal("vpc")}), false},
+		{"struct", struct {
+			Size int  `json:"size"`
+			Gp3  bool `json:"gp3"`
+		}{8, true}, cty.Object(map[string]cty.Type{"size": cty.Number, "gp3": cty.Bool}), cty.ObjectVal(map[string]cty.Value{"size": cty.NumberIntVal(8), "gp3": cty.True}), false},
+		{"json", json.RawMessage(`["a"]`), cty.Set(cty.String), cty.SetVal([]cty.Value{cty.StringVal("a")}), false},
+		{"mismatch", []string{"a"}, cty.String, cty.NilVal, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := variableValue(tt.value, tt.ty)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("variableValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.RawEquals(tt.want) {
+				t.Errorf("variableValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportVariables(t *testing.T) {
+	code := `
+variable "cidr" {}
+variable "ports" { type = list(number) }
+variable "tags" { type = map(string) }
+`
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := NewPlatform(code).BindVars(map[string]interface{}{
+		"cidr":  "10.0.0.0/16",
+		"ports": []string{"22", "443"},
+		"tags":  map[string]string{"Name": "vpc"},
+	})
+	if err := p.Export(dir); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	tfvars, err := ioutil.ReadFile(filepath.Join(dir, "terraform.tfvars"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `cidr  = "10.0.0.0/16"
+ports = [22, 443]
+tags  = { Name = "vpc" }
+`
+	if string(tfvars) != want {
+		t.Errorf("Export() terraform.tfvars =\n%s\nwant\n%s", tfvars, want)
+	}
+
+	p.Var("ports", "22")
+	if err := p.Export(dir); err == nil || !strings.Contains(err.Error(), `variable "ports"`) {
+		t.Errorf("Export() error = %v, want a type mismatch of variable \"ports\"", err)
+	}
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"context"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewClient creates the client of the manager. It works as the default caching
+// client, except that Secrets and Leases are always read from the API server: the
+// Terraform state and its lock must never be read from a stale cache.
+func NewClient(cache cache.Cache, config *rest.Config, options client.Options) (client.Client, error) {
+	c, err := client.New(config, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client.DelegatingClient{
+		Reader: &uncachedReader{
+			cacheReader:  cache,
+			clientReader: c,
+		},
+		Writer:       c,
+		StatusClient: c,
+	}, nil
+}
+
+// uncachedReader reads the objects from the cache, except for the uncached types
+type uncachedReader struct {
+	cacheReader  client.Reader
+	clientReader client.Reader
+}
+
+func (r *uncachedReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if isUncached(obj) {
+		return r.clientReader.Get(ctx, key, obj)
+	}
+	return r.cacheReader.Get(ctx, key, obj)
+}
+
+func (r *uncachedReader) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if isUncached(list) {
+		return r.clientReader.List(ctx, list, opts...)
+	}
+	return r.cacheReader.List(ctx, list, opts...)
+}
+
+func isUncached(obj runtime.Object) bool {
+	switch obj.(type) {
+	case *corev1.Secret, *corev1.SecretList, *coordinationv1.Lease, *coordinationv1.LeaseList:
+		return true
+	}
+	return false
+}
@@ -23,50 +23,50 @@ variable "subnet_cidr" {}
 variable "route_cidr" {}
 
 # Configure the VPC-Subnet
-resource "aws_vpc" "{{NET_NAME}}-vpc" {
+resource "aws_vpc" "{{ident .NET_NAME}}-vpc" {
 	cidr_block = "${var.vpc_cidr}"
 	tags = {
-		Name = "{{NET_NAME}}-vpc"
+		Name = "{{str .NET_NAME}}-vpc"
 	}
 }
 
-resource "aws_subnet" "{{NET_NAME}}-subnet-c" {
-	vpc_id = "${aws_vpc.{{NET_NAME}}-vpc.id}"
+resource "aws_subnet" "{{ident .NET_NAME}}-subnet-c" {
+	vpc_id = "${aws_vpc.{{ident .NET_NAME}}-vpc.id}"
 	cidr_block = "${var.subnet_cidr}"
 	availability_zone = "${var.region}a"
 }
 
 # Configure the Gateway
-resource "aws_internet_gateway" "{{NET_NAME}}-gateway" {
-	vpc_id = "${aws_vpc.{{NET_NAME}}-vpc.id}"
+resource "aws_internet_gateway" "{{ident .NET_NAME}}-gateway" {
+	vpc_id = "${aws_vpc.{{ident .NET_NAME}}-vpc.id}"
 	tags = {
-		Name = "{{NET_NAME}}-gateway"
+		Name = "{{str .NET_NAME}}-gateway"
 	}
 }
 
 # Configure the Routes
-resource "aws_route_table" "{{NET_NAME}}-route-table" {
-	vpc_id = "${aws_vpc.{{NET_NAME}}-vpc.id}"
+resource "aws_route_table" "{{ident .NET_NAME}}-route-table" {
+	vpc_id = "${aws_vpc.{{ident .NET_NAME}}-vpc.id}"
 	route {
 		cidr_block = "${var.route_cidr}"
-		gateway_id = "${aws_internet_gateway.{{NET_NAME}}-gateway.id}"
+		gateway_id = "${aws_internet_gateway.{{ident .NET_NAME}}-gateway.id}"
 	}
 	tags = {
-		Name = "{{NET_NAME}}-route-table"
+		Name = "{{str .NET_NAME}}-route-table"
 	}
 }
 
-resource "aws_route_table_association" "{{NET_NAME}}-subnet-association" {
-	subnet_id      = "${aws_subnet.{{NET_NAME}}-subnet-c.id}"
-	route_table_id = "${aws_route_table.{{NET_NAME}}-route-table.id}"
+resource "aws_route_table_association" "{{ident .NET_NAME}}-subnet-association" {
+	subnet_id      = "${aws_subnet.{{ident .NET_NAME}}-subnet-c.id}"
+	route_table_id = "${aws_route_table.{{ident .NET_NAME}}-route-table.id}"
 }
 
 # Configure the Security Group
-resource "aws_security_group" "{{NET_NAME}}-sg" {
-	vpc_id      = "${aws_vpc.{{NET_NAME}}-vpc.id}"
-	name        = "{{NET_NAME}}-sg"
+resource "aws_security_group" "{{ident .NET_NAME}}-sg" {
+	vpc_id      = "${aws_vpc.{{ident .NET_NAME}}-vpc.id}"
+	name        = "{{str .NET_NAME}}-sg"
 	description = "This security group is for kubernetes"
-	tags = { Name = "{{NET_NAME}}-sg" }
+	tags = { Name = "{{str .NET_NAME}}-sg" }
 }
 
 # Configure the Security Rules
@@ -76,7 +76,7 @@ resource "aws_security_group_rule" "kube-cluster-traffic" {
 	to_port           = 0
 	protocol = "-1"
 	cidr_blocks       = ["10.0.0.0/16"]
-	security_group_id = "${aws_security_group.{{NET_NAME}}-sg.id}"
+	security_group_id = "${aws_security_group.{{ident .NET_NAME}}-sg.id}"
 	lifecycle { create_before_destroy = true }
 }
 resource "aws_security_group_rule" "instance-ssh" {
@@ -85,7 +85,7 @@ resource "aws_security_group_rule" "instance-ssh" {
 	to_port           = 22
 	protocol = "TCP"
 	cidr_blocks       = ["0.0.0.0/0"]
-	security_group_id = "${aws_security_group.{{NET_NAME}}-sg.id}"
+	security_group_id = "${aws_security_group.{{ident .NET_NAME}}-sg.id}"
 	lifecycle { create_before_destroy = true }
 	}
 	
@@ -95,17 +95,17 @@ resource "aws_security_group_rule" "outbound-traffic" {
 	to_port           = 0
 	protocol          = "-1"
 	cidr_blocks       = ["0.0.0.0/0"]
-	security_group_id = "${aws_security_group.{{NET_NAME}}-sg.id}"
+	security_group_id = "${aws_security_group.{{ident .NET_NAME}}-sg.id}"
 	lifecycle { create_before_destroy = true }
 }
 	
 # Configure the Output
-output "{{NET_NAME}}-subnet-c-id" {
-	value = "${aws_subnet.{{NET_NAME}}-subnet-c.id}"
+output "{{ident .NET_NAME}}-subnet-c-id" {
+	value = "${aws_subnet.{{ident .NET_NAME}}-subnet-c.id}"
 }
 	
-output "{{NET_NAME}}-sg-id" {
-	value = "${aws_security_group.{{NET_NAME}}-sg.id}"
+output "{{ident .NET_NAME}}-sg-id" {
+	value = "${aws_security_group.{{ident .NET_NAME}}-sg.id}"
 }
 `
 
@@ -113,10 +113,10 @@ output "{{NET_NAME}}-sg-id" {
 variable "vpc_cidr" {}
 
 # Configure the VPC-Subnet
-resource "aws_vpc" "{{VPC_NAME}}" {
+resource "aws_vpc" "{{ident .VPC_NAME}}" {
 	cidr_block = "${var.vpc_cidr}"
 	tags = {
-		Name = "{{VPC_NAME}}"
+		Name = "{{str .VPC_NAME}}"
 	}
 }
 `
@@ -124,8 +124,8 @@ resource "aws_vpc" "{{VPC_NAME}}" {
 variable "subnet_cidr" {}
 variable "zone" { default = "a" }
 
-resource "aws_subnet" "{{SUBNET_NAME}}" {
-	vpc_id = "{{VPC_ID}}"
+resource "aws_subnet" "{{ident .SUBNET_NAME}}" {
+	vpc_id = "{{str .VPC_ID}}"
 	cidr_block = "${var.subnet_cidr}"
 	availability_zone = "${var.region}${var.zone}"
 }
@@ -133,10 +133,10 @@ resource "aws_subnet" "{{SUBNET_NAME}}" {
 
 	AWS_GATEWAY_TEMPLATE = `
 # Configure the Gateway
-resource "aws_internet_gateway" "{{GATEWAY_NAME}}" {
-	vpc_id = ""{{VPC_ID}}"
+resource "aws_internet_gateway" "{{ident .GATEWAY_NAME}}" {
+	vpc_id = "{{str .VPC_ID}}"
 	tags = {
-		Name = "{{GATEWAY_NAME}}"
+		Name = "{{str .GATEWAY_NAME}}"
 	}
 }
 `
@@ -144,78 +144,161 @@ resource "aws_internet_gateway" "{{GATEWAY_NAME}}" {
 variable "route_cidr" {}
 
 # Configure the Routes
-resource "aws_route_table" "{{ROUTE_NAME}}" {
-	vpc_id = "{{VPC_ID}}"
+resource "aws_route_table" "{{ident .ROUTE_NAME}}" {
+	vpc_id = "{{str .VPC_ID}}"
 	route {
 		cidr_block = "${var.route_cidr}"
-		gateway_id = "{{GATEWAY_ID}}"
+		gateway_id = "{{str .GATEWAY_ID}}"
 	}
 	tags = {
-		Name = "{{ROUTE_NAME}}"
+		Name = "{{str .ROUTE_NAME}}"
 	}
 }
 
-resource "aws_route_table_association" "{{ROUTE_NAME}}" {
-	subnet_id      = "{{SUBNET_ID}}"
-	route_table_id = "{{ROUTE_ID}}"
+resource "aws_route_table_association" "{{ident .ROUTE_NAME}}" {
+	subnet_id      = "{{str .SUBNET_ID}}"
+	route_table_id = "${aws_route_table.{{ident .ROUTE_NAME}}.id}"
 }
 `
 
 	AWS_SECURITY_GROUP_TEMPLATE = `
 # Configure the Security Group
-resource "aws_security_group" "{{SG_NAME}}" {
-	vpc_id      = "{{VPC_ID}}"
-	name        = "{{SG_NAME}}"
+resource "aws_security_group" "{{ident .SG_NAME}}" {
+	vpc_id      = "{{str .VPC_ID}}"
+	name        = "{{str .SG_NAME}}"
 	description = "This security group is for kubernetes"
-	tags = { Name = "{{SG_NAME}}" }
+	tags = { Name = "{{str .SG_NAME}}" }
 }
 `
 
 	AWS_SECURITY_GROUP_RULE_TEMPLATE = `
-resource "aws_security_group_rule" "{{SG_RULE_NAME}}" {
-	type              = "ingress"
-	from_port         = 0
-	to_port           = 0
-	protocol = "-1"
-	cidr_blocks       = ["10.0.0.0/16"]
-	security_group_id = "{{SG_ID}}"
+variable "type" {}
+variable "from_port" { type = number }
+variable "to_port" { type = number }
+variable "protocol" {}
+variable "cidr_blocks" {
+	type    = list(string)
+	default = []
+}
+variable "ipv6_cidr_blocks" {
+	type    = list(string)
+	default = []
+}
+variable "source_security_group_id" { default = "" }
+variable "self" { default = false }
+variable "description" { default = "" }
+
+resource "aws_security_group_rule" "{{ident .SG_RULE_NAME}}" {
+	type                     = var.type
+	from_port                = var.from_port
+	to_port                  = var.to_port
+	protocol                 = var.protocol
+	cidr_blocks              = length(var.cidr_blocks) > 0 ? var.cidr_blocks : null
+	ipv6_cidr_blocks         = length(var.ipv6_cidr_blocks) > 0 ? var.ipv6_cidr_blocks : null
+	source_security_group_id = var.source_security_group_id != "" ? var.source_security_group_id : null
+	self                     = var.self ? true : null
+	description              = var.description != "" ? var.description : null
+	security_group_id        = "{{str .SG_ID}}"
 	lifecycle { create_before_destroy = true }
 }
 `
 
 	AWS_KEY_TEMPLATE = `
 variable "key_pair" {default = "aws-key"}
+variable "public_key" {default = ""}
+variable "algorithm" {default = "RSA"}
+variable "key_size" {
+	type    = number
+	default = 4096
+}
 
+# Generate the key, unless the public key of an existing one is registered
 resource "tls_private_key" "example" {
-	algorithm = "RSA"
-	rsa_bits  = 4096
+	count       = var.public_key == "" ? 1 : 0
+	algorithm   = var.algorithm
+	rsa_bits    = var.algorithm == "RSA" ? var.key_size : null
+	ecdsa_curve = var.algorithm == "ECDSA" ? "P${var.key_size}" : null
+}
+
+resource "aws_key_pair" "{{ident .KEY_NAME}}" {
+	key_name   = var.key_pair
+	public_key = var.public_key != "" ? var.public_key : join("", tls_private_key.example[*].public_key_openssh)
 }
-	
-resource "aws_key_pair" "{{KEY_NAME}}" {
-	key_name = "${var.key_pair}"
-	public_key = "${tls_private_key.example.public_key_openssh}"
-}	  
 `
 
 	AWS_INSTANCE_TEMPLATE = `
-variable "key_pair" {default = "aws-key"}
+variable "key_pair" { default = "" }
 variable "instance_type" {}
 variable "image_id" {}
-	
-resource "aws_instance" "{{INS_NAME}}" {
-	ami = "${var.image_id}"
-	instance_type = "${var.instance_type}"
-	subnet_id = "{{SUBNET_ID}}"
-	vpc_security_group_ids = [
-		"{{SG_ID}}"
-	]
-	key_name = "${var.key_pair}"
-	count = 1
-	tags = {
-		Name = "{{INS_NAME}}"
+variable "instance_count" { default = 1 }
+variable "security_group_ids" {
+	type    = list(string)
+	default = []
+}
+variable "user_data" { default = "" }
+variable "iam_instance_profile" { default = "" }
+variable "associate_public_ip_address" { default = true }
+variable "private_ip" { default = "" }
+variable "tags" {
+	type    = map(string)
+	default = {}
+}
+variable "root_volume" {
+	type = list(object({
+		volume_size           = number
+		volume_type           = string
+		encrypted             = bool
+		delete_on_termination = bool
+	}))
+	default = []
+}
+variable "volumes" {
+	type = list(object({
+		device_name           = string
+		volume_size           = number
+		volume_type           = string
+		encrypted             = bool
+		delete_on_termination = bool
+	}))
+	default = []
+}
+
+resource "aws_instance" "{{ident .INS_NAME}}" {
+	count                       = var.instance_count
+	ami                         = var.image_id
+	instance_type               = var.instance_type
+	subnet_id                   = "{{str .SUBNET_ID}}"
+	vpc_security_group_ids      = var.security_group_ids
+	key_name                    = var.key_pair != "" ? var.key_pair : null
+	user_data                   = var.user_data != "" ? var.user_data : null
+	iam_instance_profile        = var.iam_instance_profile != "" ? var.iam_instance_profile : null
+	associate_public_ip_address = var.associate_public_ip_address
+	private_ip                  = var.private_ip != "" ? var.private_ip : null
+	tags = merge({
+		Name = var.instance_count > 1 ? "{{str .INS_NAME}}-${count.index}" : "{{str .INS_NAME}}"
+	}, var.tags)
+
+	dynamic "root_block_device" {
+		for_each = var.root_volume
+		content {
+			volume_size           = root_block_device.value.volume_size > 0 ? root_block_device.value.volume_size : null
+			volume_type           = root_block_device.value.volume_type != "" ? root_block_device.value.volume_type : null
+			encrypted             = root_block_device.value.encrypted
+			delete_on_termination = root_block_device.value.delete_on_termination
+		}
 	}
-	associate_public_ip_address = true
-} 
+
+	dynamic "ebs_block_device" {
+		for_each = var.volumes
+		content {
+			device_name           = ebs_block_device.value.device_name
+			volume_size           = ebs_block_device.value.volume_size > 0 ? ebs_block_device.value.volume_size : null
+			volume_type           = ebs_block_device.value.volume_type != "" ? ebs_block_device.value.volume_type : null
+			encrypted             = ebs_block_device.value.encrypted
+			delete_on_termination = ebs_block_device.value.delete_on_termination
+		}
+	}
+}
 `
 	/*
 			AWS_INSTANCE_TEMPLATE = `
@@ -256,12 +339,12 @@ provider "azurerm" {
 }
 
 # Create a resource group if it doesn't exist
-resource "azurerm_resource_group" "{{NET_NAME}}-group" {
-	name     = "{{NET_NAME}}-group"
+resource "azurerm_resource_group" "{{ident .NET_NAME}}-group" {
+	name     = "{{str .NET_NAME}}-group"
 	location = "${var.region}"
 
 	tags = {
-		environment = "{{NET_NAME}}-group"
+		environment = "{{str .NET_NAME}}-group"
 	}
 }
 `
@@ -271,40 +354,40 @@ variable "subnet_cidr" {}
 variable "route_cidr" {}
 
 # Create virtual network
-resource "azurerm_virtual_network" "{{NET_NAME}}-vpc" {
-    name                = "{{NET_NAME}}"
+resource "azurerm_virtual_network" "{{ident .NET_NAME}}-vpc" {
+    name                = "{{str .NET_NAME}}"
     address_space       = ["${var.vpc_cidr}"]
     location            = "${var.region}"
     resource_group_name = azurerm_resource_group.myterraformgroup.name
 
     tags = {
-        environment = "{{NET_NAME}}-vpc"
+        environment = "{{str .NET_NAME}}-vpc"
     }
 }
 
 # Create subnet
-resource "azurerm_subnet" "{{NET_NAME}}-subnet" {
-    name                 = "{{NET_NAME}}"
+resource "azurerm_subnet" "{{ident .NET_NAME}}-subnet" {
+    name                 = "{{str .NET_NAME}}"
     resource_group_name  = azurerm_resource_group.myterraformgroup.name
-    virtual_network_name = azurerm_virtual_network.{{NET_NAME}}-vpc.name
+    virtual_network_name = azurerm_virtual_network.{{ident .NET_NAME}}-vpc.name
     address_prefixes       = ["${var.subnet_cidr}"]
 }
 
 # Create public IPs
-resource "azurerm_public_ip" "{{NET_NAME}}-publicip" {
-    name                         = "{{NET_NAME}}-publicip"
+resource "azurerm_public_ip" "{{ident .NET_NAME}}-publicip" {
+    name                         = "{{str .NET_NAME}}-publicip"
     location                     = "${var.region}"
     resource_group_name          = azurerm_resource_group.myterraformgroup.name
     allocation_method            = "Dynamic"
 
     tags = {
-        environment = "{{NET_NAME}}-publicip"
+        environment = "{{str .NET_NAME}}-publicip"
     }
 }
 
 # Create Network Security Group and rule
-resource "azurerm_network_security_group" "{{NET_NAME}}-sg" {
-    name                = "{{NET_NAME}}-sg"
+resource "azurerm_network_security_group" "{{ident .NET_NAME}}-sg" {
+    name                = "{{str .NET_NAME}}-sg"
     location            = "${var.region}"
     resource_group_name = azurerm_resource_group.myterraformgroup.name
 
@@ -321,31 +404,31 @@ resource "azurerm_network_security_group" "{{NET_NAME}}-sg" {
     }
 
     tags = {
-        environment = "{{NET_NAME}}-sg"
+        environment = "{{str .NET_NAME}}-sg"
     }
 }
 # Create network interface
-resource "azurerm_network_interface" "{{NET_NAME}}-nic" {
-    name                      = "{{NET_NAME}}-nic"
+resource "azurerm_network_interface" "{{ident .NET_NAME}}-nic" {
+    name                      = "{{str .NET_NAME}}-nic"
     location                  = "${var.region}"
     resource_group_name       = azurerm_resource_group.myterraformgroup.name
 
     ip_configuration {
-        name                          = "{{NET_NAME}}-nicconfiguration"
-        subnet_id                     = azurerm_subnet.{{NET_NAME}}-subnet.id
+        name                          = "{{str .NET_NAME}}-nicconfiguration"
+        subnet_id                     = azurerm_subnet.{{ident .NET_NAME}}-subnet.id
         private_ip_address_allocation = "Dynamic"
-        public_ip_address_id          = azurerm_public_ip.{{NET_NAME}}-publicip.id
+        public_ip_address_id          = azurerm_public_ip.{{ident .NET_NAME}}-publicip.id
     }
 
     tags = {
-        environment = "{{NET_NAME}}-nic"
+        environment = "{{str .NET_NAME}}-nic"
     }
 }
 
 # Connect the security group to the network interface
-resource "azurerm_network_interface_security_group_association" "{{NET_NAME}}" {
-    network_interface_id      = azurerm_network_interface.{{NET_NAME}}-nic.id
-    network_security_group_id = azurerm_network_security_group.{{NET_NAME}}-sg.id
+resource "azurerm_network_interface_security_group_association" "{{ident .NET_NAME}}" {
+    network_interface_id      = azurerm_network_interface.{{ident .NET_NAME}}-nic.id
+    network_security_group_id = azurerm_network_security_group.{{ident .NET_NAME}}-sg.id
 }
 `
 	AZURE_INSTANCE_TEMPLATE = `
@@ -377,11 +460,11 @@ resource "azurerm_storage_account" "mystorageaccount" {
 }
 
 # Create virtual machine
-resource "azurerm_linux_virtual_machine" "{{INS_NAME}}" {
-    name                  = "{{INS_NAME}}"
+resource "azurerm_linux_virtual_machine" "{{ident .INS_NAME}}" {
+    name                  = "{{str .INS_NAME}}"
     location              = "${var.region}"
     resource_group_name   = azurerm_resource_group.myterraformgroup.name
-    network_interface_ids = [azurerm_network_interface.{{NET_NAME}}-nic.id]
+    network_interface_ids = [azurerm_network_interface.{{ident .NET_NAME}}-nic.id]
     size                  = "${var.instance_type}"
 
     os_disk {
@@ -390,7 +473,7 @@ resource "azurerm_linux_virtual_machine" "{{INS_NAME}}" {
         storage_account_type = "Premium_LRS"
     }
 
-    source_image_id = "${var.image_id}
+    source_image_id = "${var.image_id}"
     #source_image_reference {
     #    publisher = "Canonical"
     #    offer     = "UbuntuServer"
@@ -398,7 +481,7 @@ resource "azurerm_linux_virtual_machine" "{{INS_NAME}}" {
     #    version   = "latest"
     #}
 
-    computer_name  = "{{INS_NAME}}"
+    computer_name  = "{{str .INS_NAME}}"
     admin_username = "azureuser"
     disable_password_authentication = true
 
@@ -412,7 +495,7 @@ resource "azurerm_linux_virtual_machine" "{{INS_NAME}}" {
     }
 
     tags = {
-        environment = "{{INS_NAME}}"
+        environment = "{{str .INS_NAME}}"
     }
 }
 	`
@@ -0,0 +1,556 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/packfile"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/capability"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp/sideband"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tmax-cloud/terraform-operator/terranova"
+)
+
+// Keys of the Secret of the credentials of a Git repository
+const (
+	GitUsernameKey   = "username"
+	GitPasswordKey   = "password"
+	GitTokenKey      = "token"
+	GitIdentityKey   = "identity"
+	GitPassphraseKey = "passphrase"
+	GitKnownHostsKey = "known_hosts"
+	GitCAKey         = "ca.crt"
+)
+
+// DefaultGitSSHUser is the SSH user when the URL has none
+const DefaultGitSSHUser = "git"
+
+// GitCredentials are the credentials of a Git repository
+type GitCredentials struct {
+	// Auth is the auth method of the transport of the repository
+	Auth transport.AuthMethod
+	// rootCAs check the certificates of the HTTPS server, instead of the
+	// system CAs, if not nil
+	rootCAs *x509.CertPool
+}
+
+// GitAuth returns the credentials of the Git repository of the URL read from
+// the Secret, or nil if the Secret is nil. The errors never hold the
+// credentials.
+func GitAuth(rawURL string, secret *corev1.Secret) (*GitCredentials, error) {
+	if secret == nil {
+		return nil, nil
+	}
+	data := func(key string) string {
+		return string(secret.Data[key])
+	}
+
+	endpoint, err := transport.NewEndpoint(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s. %s", RedactURL(rawURL), err)
+	}
+
+	creds := &GitCredentials{}
+	if ca := secret.Data[GitCAKey]; len(ca) != 0 {
+		if endpoint.Protocol != "https" {
+			return nil, fmt.Errorf("%s is only used by HTTPS repositories", GitCAKey)
+		}
+		if creds.rootCAs, err = x509.SystemCertPool(); err != nil {
+			creds.rootCAs = x509.NewCertPool()
+		}
+		if !creds.rootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", GitCAKey)
+		}
+	}
+
+	switch endpoint.Protocol {
+	case "ssh":
+		if data(GitIdentityKey) == "" {
+			return nil, fmt.Errorf("key %q not found in the Secret %s", GitIdentityKey, secret.Name)
+		}
+		if data(GitKnownHostsKey) == "" {
+			return nil, fmt.Errorf("key %q not found in the Secret %s, it's required to check the host key of %s", GitKnownHostsKey, secret.Name, endpoint.Host)
+		}
+
+		user := endpoint.User
+		if user == "" {
+			user = DefaultGitSSHUser
+		}
+		auth, err := gitssh.NewPublicKeys(user, secret.Data[GitIdentityKey], data(GitPassphraseKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in the Secret %s. %s", GitIdentityKey, secret.Name, err)
+		}
+		if auth.HostKeyCallback, err = knownHostsCallback(secret.Data[GitKnownHostsKey]); err != nil {
+			return nil, fmt.Errorf("invalid %s in the Secret %s. %s", GitKnownHostsKey, secret.Name, err)
+		}
+		creds.Auth = auth
+	case "http", "https":
+		if token := data(GitTokenKey); token != "" {
+			creds.Auth = &githttp.TokenAuth{Token: token}
+		} else if data(GitUsernameKey) != "" || data(GitPasswordKey) != "" {
+			creds.Auth = &githttp.BasicAuth{Username: data(GitUsernameKey), Password: data(GitPasswordKey)}
+		}
+	}
+	return creds, nil
+}
+
+// uploadPackSession opens a session fetching from the Git repository of the
+// URL. The HTTPS server is checked with the CA bundle of the credentials by a
+// client of this session only, the clients of go-git are shared by all the
+// repositories.
+func uploadPackSession(rawURL string, creds *GitCredentials) (transport.UploadPackSession, error) {
+	endpoint, err := transport.NewEndpoint(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	c, err := client.NewClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if creds == nil {
+		return c.NewUploadPackSession(endpoint, nil)
+	}
+
+	if creds.rootCAs != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: creds.rootCAs}
+		// The connections are not kept, the transport is dropped with the session
+		transport.DisableKeepAlives = true
+		c = githttp.NewClient(&http.Client{Transport: transport})
+	}
+	return c.NewUploadPackSession(endpoint, creds.Auth)
+}
+
+// knownHostsCallback returns the callback checking the host keys are in the
+// known_hosts
+func knownHostsCallback(knownHosts []byte) (gossh.HostKeyCallback, error) {
+	file, err := ioutil.TempFile("", "known_hosts")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(knownHosts)
+	if cErr := file.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return knownhosts.New(file.Name())
+}
+
+// RedactURL returns the URL without the password it may hold
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "redacted")
+	}
+	return u.String()
+}
+
+// GitRevision is the revision of a Git repository checked out by
+// SyncRepository
+type GitRevision struct {
+	// Commit is the hash of the checked out commit
+	Commit string
+	// Tag is the tag of the commit, when the ref is a tag or a version range
+	Tag string
+}
+
+// SyncRepository checks out the ref of the Git repository of the URL into dir,
+// where it's cached between syncs. The ref is one of:
+//   - a branch, or the default branch of the repository if it's empty
+//   - a tag
+//   - a version range on the tags, e.g. "~> 1.2" or ">= 1.0, < 2.0", the
+//     highest matching version is checked out
+//   - the full hash of a commit
+//
+// Only the commit of the ref is fetched, without its history, and only when
+// it's not in the cache yet. The history is fetched for a hash only, if the
+// commit isn't in the cache.
+func SyncRepository(dir, url, ref string, creds *GitCredentials) (GitRevision, error) {
+	repo, err := openRepository(dir, url)
+	if err != nil {
+		return GitRevision{}, err
+	}
+	if repo == nil {
+		if repo, err = initRepository(dir, url); err != nil {
+			return GitRevision{}, err
+		}
+	}
+
+	// The cached commits are checked out without connecting to the repository
+	if isCommitHash(ref) {
+		if _, err := repo.CommitObject(plumbing.NewHash(ref)); err == nil {
+			return checkoutRevision(repo, plumbing.NewHash(ref), "")
+		}
+	}
+
+	session, err := uploadPackSession(url, creds)
+	if err != nil {
+		return GitRevision{}, fmt.Errorf("failed to connect to %s. %s", RedactURL(url), err)
+	}
+	defer session.Close()
+	refs, err := remoteRefs(session)
+	if err != nil {
+		return GitRevision{}, fmt.Errorf("failed to list the refs of %s. %s", RedactURL(url), err)
+	}
+
+	if isCommitHash(ref) {
+		return syncCommit(repo, session, refs, url, plumbing.NewHash(ref))
+	}
+
+	remoteRef, tag, err := resolveRef(refs, ref)
+	if err != nil {
+		return GitRevision{}, fmt.Errorf("%s in %s", err, RedactURL(url))
+	}
+
+	// Fetch the head of the ref only, unless it's already in the cache
+	if _, err := peel(repo, remoteRef.Hash()); err != nil {
+		localName := plumbing.ReferenceName("refs/tags/" + tag)
+		if tag == "" {
+			localName = plumbing.NewRemoteReferenceName(git.DefaultRemoteName, remoteRef.Name().Short())
+		}
+		updates := map[plumbing.ReferenceName]plumbing.Hash{localName: remoteRef.Hash()}
+		if err := fetch(repo, session, updates, 1); err != nil {
+			return GitRevision{}, fmt.Errorf("failed to fetch %s of %s. %s", remoteRef.Name().Short(), RedactURL(url), err)
+		}
+	}
+
+	commit, err := peel(repo, remoteRef.Hash())
+	if err != nil {
+		return GitRevision{}, err
+	}
+	return checkoutRevision(repo, commit, tag)
+}
+
+// syncCommit checks out the commit, fetching the whole history of the
+// repository for it
+func syncCommit(repo *git.Repository, session transport.UploadPackSession, refs []*plumbing.Reference, url string, commit plumbing.Hash) (GitRevision, error) {
+	updates := map[plumbing.ReferenceName]plumbing.Hash{}
+	for _, ref := range refs {
+		switch {
+		case ref.Type() != plumbing.HashReference:
+		case ref.Name().IsBranch():
+			updates[plumbing.NewRemoteReferenceName(git.DefaultRemoteName, ref.Name().Short())] = ref.Hash()
+		case ref.Name().IsTag():
+			updates[ref.Name()] = ref.Hash()
+		}
+	}
+	if len(updates) == 0 {
+		return GitRevision{}, fmt.Errorf("commit %s not found in %s", commit, RedactURL(url))
+	}
+	if err := fetch(repo, session, updates, 0); err != nil {
+		return GitRevision{}, fmt.Errorf("failed to fetch %s. %s", RedactURL(url), err)
+	}
+	if err := pruneRefs(repo, updates); err != nil {
+		return GitRevision{}, err
+	}
+	if _, err := repo.CommitObject(commit); err != nil {
+		return GitRevision{}, fmt.Errorf("commit %s not found in %s", commit, RedactURL(url))
+	}
+	return checkoutRevision(repo, commit, "")
+}
+
+// remoteRefs returns the references of the repository of the session
+func remoteRefs(session transport.UploadPackSession) ([]*plumbing.Reference, error) {
+	ar, err := session.AdvertisedReferences()
+	if err != nil {
+		return nil, err
+	}
+	all, err := ar.AllReferences()
+	if err != nil {
+		return nil, err
+	}
+	var refs []*plumbing.Reference
+	for _, ref := range all {
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// fetch fetches the commits of the updates from the repository of the
+// session, up to depth commits if it's not 0, and sets the references of the
+// updates to them once fetched. The local commits are not sent to the server:
+// go-git can't tell it the history behind them is shallow, the server sends
+// the whole commits.
+func fetch(repo *git.Repository, session transport.UploadPackSession, updates map[plumbing.ReferenceName]plumbing.Hash, depth int) error {
+	if err := fetchPack(repo, session, updates, depth); err != nil {
+		return err
+	}
+	for name, hash := range updates {
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneRefs removes the branches and tags of the repository which are not in
+// the updates, they were removed from the remote repository
+func pruneRefs(repo *git.Repository, updates map[plumbing.ReferenceName]plumbing.Hash) error {
+	refs, err := repo.References()
+	if err != nil {
+		return err
+	}
+	return refs.ForEach(func(ref *plumbing.Reference) error {
+		if _, ok := updates[ref.Name()]; ok || !(ref.Name().IsRemote() || ref.Name().IsTag()) {
+			return nil
+		}
+		return repo.Storer.RemoveReference(ref.Name())
+	})
+}
+
+// fetchPack fetches the objects of the commits of the updates, up to depth
+// commits if it's not 0, into the repository
+func fetchPack(repo *git.Repository, session transport.UploadPackSession, updates map[plumbing.ReferenceName]plumbing.Hash, depth int) (err error) {
+	ar, err := session.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	if depth != 0 {
+		req.Depth = packp.DepthCommits(depth)
+		if err := req.Capabilities.Set(capability.Shallow); err != nil {
+			return err
+		}
+	}
+	if ar.Capabilities.Supports(capability.NoProgress) {
+		if err := req.Capabilities.Set(capability.NoProgress); err != nil {
+			return err
+		}
+	}
+	wanted := map[plumbing.Hash]bool{}
+	for _, hash := range updates {
+		if !wanted[hash] {
+			wanted[hash] = true
+			req.Wants = append(req.Wants, hash)
+		}
+	}
+
+	resp, err := session.UploadPack(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cErr := resp.Close(); err == nil {
+			err = cErr
+		}
+	}()
+
+	if len(resp.Shallows) != 0 {
+		shallows, err := repo.Storer.Shallow()
+		if err != nil {
+			return err
+		}
+		known := map[plumbing.Hash]bool{}
+		for _, hash := range shallows {
+			known[hash] = true
+		}
+		for _, hash := range resp.Shallows {
+			if !known[hash] {
+				shallows = append(shallows, hash)
+			}
+		}
+		if err := repo.Storer.SetShallow(shallows); err != nil {
+			return err
+		}
+	}
+
+	var reader io.Reader = resp
+	switch {
+	case req.Capabilities.Supports(capability.Sideband64k):
+		reader = sideband.NewDemuxer(sideband.Sideband64k, resp)
+	case req.Capabilities.Supports(capability.Sideband):
+		reader = sideband.NewDemuxer(sideband.Sideband, resp)
+	}
+	return packfile.UpdateObjectStorage(repo.Storer, reader)
+}
+
+// resolveRef returns the remote reference of the ref among the references of
+// the repository, and the tag it is if any
+func resolveRef(refs []*plumbing.Reference, ref string) (*plumbing.Reference, string, error) {
+	byName := map[plumbing.ReferenceName]*plumbing.Reference{}
+	for _, r := range refs {
+		byName[r.Name()] = r
+	}
+
+	if ref == "" || ref == "HEAD" {
+		head, ok := byName[plumbing.HEAD]
+		if !ok || head.Type() != plumbing.SymbolicReference {
+			return nil, "", fmt.Errorf("default branch not found")
+		}
+		ref = head.Target().Short()
+	}
+
+	if r, ok := byName[plumbing.NewBranchReferenceName(ref)]; ok {
+		return r, "", nil
+	}
+	if r, ok := byName[plumbing.NewTagReferenceName(ref)]; ok {
+		return r, ref, nil
+	}
+
+	constraints, err := version.NewConstraint(ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("branch or tag %s not found", ref)
+	}
+	var latest *version.Version
+	var latestRef *plumbing.Reference
+	for _, r := range refs {
+		if !r.Name().IsTag() {
+			continue
+		}
+		v, err := version.NewVersion(r.Name().Short())
+		if err != nil || !constraints.Check(v) {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest, latestRef = v, r
+		}
+	}
+	if latestRef == nil {
+		return nil, "", fmt.Errorf("no tag matches the version range %s", ref)
+	}
+	return latestRef, latestRef.Name().Short(), nil
+}
+
+// peel returns the commit of the hash, which is a commit or an annotated tag.
+// It fails if the commit is not in the repository.
+func peel(repo *git.Repository, hash plumbing.Hash) (plumbing.Hash, error) {
+	tag, err := repo.TagObject(hash)
+	if err == plumbing.ErrObjectNotFound {
+		if _, err := repo.CommitObject(hash); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("commit %s not found. %s", hash, err)
+		}
+		return hash, nil
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	commit, err := tag.Commit()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("tag %s is not a commit. %s", tag.Name, err)
+	}
+	return commit.Hash, nil
+}
+
+// isCommitHash returns whether the ref is the full hash of a commit
+func isCommitHash(ref string) bool {
+	if len(ref) != 40 {
+		return false
+	}
+	for _, c := range ref {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// initRepository creates an empty Git repository in dir, with the URL as its
+// origin
+func initRepository(dir, url string) (*git.Repository, error) {
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	_, err = repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{url}})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return repo, nil
+}
+
+// openRepository opens the Git repository cloned into dir, or returns nil if
+// there's none. A repository cloned from another URL is removed.
+func openRepository(dir, url string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(dir)
+	if err == git.ErrRepositoryNotExists {
+		return nil, os.RemoveAll(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil || len(remote.Config().URLs) == 0 || remote.Config().URLs[0] != url {
+		return nil, os.RemoveAll(dir)
+	}
+	return repo, nil
+}
+
+// checkoutRevision checks out the commit, the revision of the tag if any
+func checkoutRevision(repo *git.Repository, commit plumbing.Hash, tag string) (GitRevision, error) {
+	if err := checkout(repo, commit); err != nil {
+		return GitRevision{}, err
+	}
+	return GitRevision{Commit: commit.String(), Tag: tag}, nil
+}
+
+func checkout(repo *git.Repository, hash plumbing.Hash) error {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+		return fmt.Errorf("failed to checkout commit %s. %s", hash, err)
+	}
+	return nil
+}
+
+// ReadCode returns the Terraform files of the root module in the directory
+// and of the local modules it calls, by path relative to the directory. The
+// other files, e.g. the ones of the other stacks of the repository, are not
+// read.
+func ReadCode(dir, rootModule string) (map[string]string, error) {
+	moduleDirs, err := terranova.ModuleDirs(dir, rootModule)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{}
+	for _, moduleDir := range moduleDirs {
+		infos, err := ioutil.ReadDir(filepath.Join(dir, moduleDir))
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if !info.Mode().IsRegular() || !(strings.HasSuffix(info.Name(), ".tf") || strings.HasSuffix(info.Name(), ".tf.json")) {
+				continue
+			}
+			path := filepath.Join(moduleDir, info.Name())
+			content, err := ioutil.ReadFile(filepath.Join(dir, path))
+			if err != nil {
+				return nil, err
+			}
+			files[path] = string(content)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,195 @@
+package util
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ResourceKind describes how a kind of cloud resource is provisioned by Terraform
+type ResourceKind interface {
+	// Code returns the HCL code of the resource
+	Code(input TerraVars) (string, error)
+
+	// Vars returns the values of the variables declared in the HCL code
+	Vars(input TerraVars) map[string]interface{}
+
+	// Providers returns new instances of the Terraform providers required by
+	// the HCL code. They're configured by Terraform, so they can't be shared.
+	Providers() map[string]terraform.ResourceProvider
+
+	// Address returns the address of the main resource of the HCL code, the
+	// one identified by the ID of the kind
+	Address(input TerraVars) string
+
+	// ImportAddress returns the address of the resource of the HCL code
+	// which adopts an existing remote resource, or "" if the kind can't
+	// import it
+	ImportAddress(input TerraVars) string
+}
+
+var (
+	kindsMu sync.RWMutex
+	kinds   = make(map[string]ResourceKind)
+)
+
+func kindKey(cloud, kind string) string {
+	return cloud + "/" + kind
+}
+
+// RegisterKind makes a resource kind of the cloud available to ExecuteTerraform
+// and PlanTerraform. It panics if the kind is registered twice.
+func RegisterKind(cloud, kind string, k ResourceKind) {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+
+	key := kindKey(cloud, kind)
+	if _, dup := kinds[key]; dup {
+		panic("resource kind " + key + " registered twice")
+	}
+	kinds[key] = k
+}
+
+// LookupKind returns the registered resource kind of the cloud
+func LookupKind(cloud, kind string) (ResourceKind, error) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+
+	k, ok := kinds[kindKey(cloud, kind)]
+	if !ok {
+		return nil, fmt.Errorf("Not Found Error: Resource Type %q of Cloud Platform %q", kind, cloud)
+	}
+	return k, nil
+}
+
+// templateKind is a resource kind rendered from an HCL template. The template
+// is a text/template whose data are the placeholders: `{{ident .NAME}}` inserts
+// an identifier, e.g. in a resource name, and `{{str .NAME}}` inserts the
+// escaped content of a quoted string.
+type templateKind struct {
+	template     string
+	placeholders func(input TerraVars) map[string]string
+	vars         func(input TerraVars) map[string]interface{}
+	providers    func() map[string]terraform.ResourceProvider
+
+	// address returns the address of the main resource
+	address func(input TerraVars) string
+
+	// noImport is true if the main resource can't be imported
+	noImport bool
+}
+
+func (k *templateKind) Code(input TerraVars) (string, error) {
+	tmpl, err := template.New(input.Type).
+		Funcs(hclFuncs).
+		Option("missingkey=error").
+		Parse(k.template)
+	if err != nil {
+		return "", err
+	}
+
+	placeholders := map[string]string{}
+	if k.placeholders != nil {
+		placeholders = k.placeholders(input)
+	}
+
+	var code strings.Builder
+	if err := tmpl.Execute(&code, placeholders); err != nil {
+		return "", fmt.Errorf("failed to render the code of %s. %s", input.Type, err)
+	}
+	return code.String(), nil
+}
+
+func (k *templateKind) Vars(input TerraVars) map[string]interface{} {
+	if k.vars == nil {
+		return nil
+	}
+	return k.vars(input)
+}
+
+func (k *templateKind) Providers() map[string]terraform.ResourceProvider {
+	return k.providers()
+}
+
+func (k *templateKind) Address(input TerraVars) string {
+	return k.address(input)
+}
+
+func (k *templateKind) ImportAddress(input TerraVars) string {
+	if k.noImport {
+		return ""
+	}
+	return k.address(input)
+}
+
+// ProviderFile is the file of the code of the provider, added to the files of
+// the user code
+const ProviderFile = "terraform-operator-provider.tf"
+
+// userCodeKind is a resource kind whose HCL code is supplied by the user, in
+// the HCLFiles. Its code is the code of the provider of the cloud, added to
+// the root module, the user code must not configure the provider nor read the
+// files of the operator, see checkUserCode.
+type userCodeKind struct {
+	provider  string
+	vars      func(input TerraVars) map[string]interface{}
+	providers func() map[string]terraform.ResourceProvider
+}
+
+func (k *userCodeKind) Code(input TerraVars) (string, error) {
+	if len(input.HCLFiles) == 0 && !input.HCLStateOnly {
+		return "", fmt.Errorf("no code to apply for %s %s", input.Type, input.Name)
+	}
+	if _, ok := input.HCLFiles[filepath.Join(input.HCLRootModule, ProviderFile)]; ok {
+		return "", fmt.Errorf("the file %s of the code is reserved for the provider", ProviderFile)
+	}
+	if err := checkUserCode(input.HCLFiles); err != nil {
+		return "", err
+	}
+	return k.provider, nil
+}
+
+func (k *userCodeKind) Vars(input TerraVars) map[string]interface{} {
+	return k.vars(input)
+}
+
+func (k *userCodeKind) Providers() map[string]terraform.ResourceProvider {
+	return k.providers()
+}
+
+// Address returns "", the user code has no main resource
+func (k *userCodeKind) Address(input TerraVars) string {
+	return ""
+}
+
+func (k *userCodeKind) ImportAddress(input TerraVars) string {
+	return ""
+}
+
+// hclFuncs are the functions escaping the values inserted in the HCL templates
+var hclFuncs = template.FuncMap{
+	"ident": hclIdent,
+	"str":   hclString,
+}
+
+// hclIdent returns the value if it's a valid HCL identifier
+func hclIdent(value string) (string, error) {
+	if !hclsyntax.ValidIdentifier(value) {
+		return "", fmt.Errorf("%q is not a valid name, it must start with a letter or underscore and may contain only letters, digits, underscores and dashes", value)
+	}
+	return value, nil
+}
+
+// hclString returns the value escaped to be inserted in a quoted string, so
+// quotes and template sequences like `${` are kept as they are
+func hclString(value string) string {
+	quoted := hclwrite.TokensForValue(cty.StringVal(value)).Bytes()
+	return string(quoted[1 : len(quoted)-1])
+}
@@ -0,0 +1,231 @@
+package util
+
+import (
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/terraform-providers/terraform-provider-aws/aws"
+	"github.com/terraform-providers/terraform-provider-tls/tls"
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+)
+
+// Cloud Platforms
+const (
+	CloudAWS   = "AWS"
+	CloudAzure = "Azure"
+)
+
+func init() {
+	RegisterKind(CloudAWS, "AWSVPC", &templateKind{
+		template: AWS_PROVIDER_TEMPLATE + "\n" + AWS_VPC_TEMPLATE,
+		placeholders: func(input TerraVars) map[string]string {
+			return map[string]string{"VPC_NAME": input.VPCName}
+		},
+		vars: awsVars(func(input TerraVars, vars map[string]interface{}) {
+			vars["vpc_cidr"] = input.VPCCIDR
+		}),
+		providers: awsProviders,
+		address: func(input TerraVars) string {
+			return "aws_vpc." + input.VPCName
+		},
+	})
+
+	RegisterKind(CloudAWS, "AWSSubnet", &templateKind{
+		template: AWS_PROVIDER_TEMPLATE + "\n" + AWS_SUBNET_TEMPLATE,
+		placeholders: func(input TerraVars) map[string]string {
+			return map[string]string{"SUBNET_NAME": input.SubnetName, "VPC_ID": input.VPCID}
+		},
+		vars: awsVars(func(input TerraVars, vars map[string]interface{}) {
+			vars["subnet_cidr"] = input.SubnetCIDR
+			vars["zone"] = input.Zone
+		}),
+		providers: awsProviders,
+		address: func(input TerraVars) string {
+			return "aws_subnet." + input.SubnetName
+		},
+	})
+
+	RegisterKind(CloudAWS, "AWSGateway", &templateKind{
+		template: AWS_PROVIDER_TEMPLATE + "\n" + AWS_GATEWAY_TEMPLATE,
+		placeholders: func(input TerraVars) map[string]string {
+			return map[string]string{"GATEWAY_NAME": input.GatewayName, "VPC_ID": input.VPCID}
+		},
+		vars:      awsVars(nil),
+		providers: awsProviders,
+		address: func(input TerraVars) string {
+			return "aws_internet_gateway." + input.GatewayName
+		},
+	})
+
+	RegisterKind(CloudAWS, "AWSRoute", &templateKind{
+		template: AWS_PROVIDER_TEMPLATE + "\n" + AWS_ROUTE_TEMPLATE,
+		placeholders: func(input TerraVars) map[string]string {
+			return map[string]string{
+				"ROUTE_NAME": input.RouteName,
+				"VPC_ID":     input.VPCID,
+				"GATEWAY_ID": input.GatewayID,
+				"SUBNET_ID":  input.SubnetID,
+			}
+		},
+		vars: awsVars(func(input TerraVars, vars map[string]interface{}) {
+			vars["route_cidr"] = input.RouteCIDR
+		}),
+		providers: awsProviders,
+		address: func(input TerraVars) string {
+			return "aws_route_table." + input.RouteName
+		},
+	})
+
+	RegisterKind(CloudAWS, "AWSSecurityGroup", &templateKind{
+		template: AWS_PROVIDER_TEMPLATE + "\n" + AWS_SECURITY_GROUP_TEMPLATE,
+		placeholders: func(input TerraVars) map[string]string {
+			return map[string]string{"SG_NAME": input.SGName, "VPC_ID": input.VPCID}
+		},
+		vars:      awsVars(nil),
+		providers: awsProviders,
+		address: func(input TerraVars) string {
+			return "aws_security_group." + input.SGName
+		},
+	})
+
+	RegisterKind(CloudAWS, "AWSSecurityGroupRule", &templateKind{
+		template: AWS_PROVIDER_TEMPLATE + "\n" + AWS_SECURITY_GROUP_RULE_TEMPLATE,
+		placeholders: func(input TerraVars) map[string]string {
+			return map[string]string{"SG_RULE_NAME": input.SGRuleName, "SG_ID": input.SGID}
+		},
+		vars: awsVars(func(input TerraVars, vars map[string]interface{}) {
+			vars["type"] = input.SGType
+			vars["from_port"] = input.FromPort
+			vars["to_port"] = input.ToPort
+			vars["protocol"] = input.Protocol
+			vars["cidr_blocks"] = append([]string{}, input.SGCIDRs...)
+			vars["ipv6_cidr_blocks"] = append([]string{}, input.SGIPv6CIDRs...)
+			vars["source_security_group_id"] = input.SourceSGID
+			vars["self"] = input.SGSelf
+			vars["description"] = input.SGDescription
+		}),
+		providers: awsProviders,
+		address: func(input TerraVars) string {
+			return "aws_security_group_rule." + input.SGRuleName
+		},
+		// The import ID of a rule is made of its fields, not of its ID
+		noImport: true,
+	})
+
+	RegisterKind(CloudAWS, "AWSKey", &templateKind{
+		template: AWS_PROVIDER_TEMPLATE + "\n" + AWS_KEY_TEMPLATE,
+		placeholders: func(input TerraVars) map[string]string {
+			return map[string]string{"KEY_NAME": input.KeyName}
+		},
+		vars: awsVars(func(input TerraVars, vars map[string]interface{}) {
+			vars["key_pair"] = input.KeyName
+			vars["public_key"] = input.PublicKey
+			if input.KeyAlgorithm != "" {
+				vars["algorithm"] = input.KeyAlgorithm
+			}
+			if input.KeySize != 0 {
+				vars["key_size"] = input.KeySize
+			}
+		}),
+		providers: awsTLSProviders,
+		address: func(input TerraVars) string {
+			return "aws_key_pair." + input.KeyName
+		},
+	})
+
+	RegisterKind(CloudAWS, "AWSInstance", &templateKind{
+		template: AWS_PROVIDER_TEMPLATE + "\n" + AWS_INSTANCE_TEMPLATE,
+		placeholders: func(input TerraVars) map[string]string {
+			return map[string]string{"INS_NAME": input.InstanceName, "SUBNET_ID": input.SubnetID}
+		},
+		vars: awsVars(func(input TerraVars, vars map[string]interface{}) {
+			vars["instance_type"] = input.InstanceType
+			vars["image_id"] = input.ImageID
+			vars["key_pair"] = input.KeyName
+			vars["instance_count"] = 1
+			if input.InstanceCount > 0 {
+				vars["instance_count"] = input.InstanceCount
+			}
+			vars["security_group_ids"] = append([]string{}, input.SGIDs...)
+			vars["user_data"] = input.UserData
+			vars["iam_instance_profile"] = input.IAMInstanceProfile
+			vars["associate_public_ip_address"] = input.AssociatePublicIP
+			vars["private_ip"] = input.PrivateIP
+			vars["tags"] = instanceTags(input.InstanceTags)
+			vars["root_volume"] = []map[string]interface{}{}
+			if input.RootVolume != nil {
+				vars["root_volume"] = awsVolumes([]terraformv1alpha1.AWSVolume{*input.RootVolume})
+			}
+			vars["volumes"] = awsVolumes(input.Volumes)
+		}),
+		providers: awsTLSProviders,
+		address: func(input TerraVars) string {
+			return "aws_instance." + input.InstanceName + "[0]"
+		},
+	})
+
+	// The variables of the provider can't be set by the user code
+	userCode := &userCodeKind{
+		provider: AWS_PROVIDER_TEMPLATE,
+		vars: awsVars(func(input TerraVars, vars map[string]interface{}) {
+			for name, value := range input.HCLVars {
+				if _, ok := vars[name]; !ok {
+					vars[name] = value
+				}
+			}
+		}),
+		providers: awsTLSProviders,
+	}
+	RegisterKind(CloudAWS, "HCL", userCode)
+	RegisterKind(CloudAWS, "Repository", userCode)
+}
+
+// awsVars returns the variables of an AWS kind: the variables of the provider
+// plus the ones set by kindVars
+func awsVars(kindVars func(input TerraVars, vars map[string]interface{})) func(input TerraVars) map[string]interface{} {
+	return func(input TerraVars) map[string]interface{} {
+		vars := map[string]interface{}{
+			"access_key": input.AccessKey,
+			"secret_key": input.SecretKey,
+			"region":     input.Region,
+		}
+		if kindVars != nil {
+			kindVars(input, vars)
+		}
+		return vars
+	}
+}
+
+// instanceTags returns the tags of an instance, never nil
+func instanceTags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return map[string]string{}
+	}
+	return tags
+}
+
+// awsVolumes returns the values of the volume objects of an instance
+func awsVolumes(volumes []terraformv1alpha1.AWSVolume) []map[string]interface{} {
+	values := []map[string]interface{}{}
+	for _, volume := range volumes {
+		values = append(values, map[string]interface{}{
+			"device_name":           volume.DeviceName,
+			"volume_size":           volume.Size,
+			"volume_type":           volume.Type,
+			"encrypted":             volume.Encrypted,
+			"delete_on_termination": volume.GetDeleteOnTermination(),
+		})
+	}
+	return values
+}
+
+func awsProviders() map[string]terraform.ResourceProvider {
+	return map[string]terraform.ResourceProvider{
+		"aws": aws.Provider(),
+	}
+}
+
+func awsTLSProviders() map[string]terraform.ResourceProvider {
+	return map[string]terraform.ResourceProvider{
+		"aws": aws.Provider(),
+		"tls": tls.Provider(),
+	}
+}
@@ -0,0 +1,264 @@
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+	"github.com/tmax-cloud/terraform-operator/terranova"
+)
+
+func TestAWSKinds(t *testing.T) {
+	input := TerraVars{
+		Name:         "test",
+		Cloud:        CloudAWS,
+		VPCName:      "vpc",
+		VPCID:        "vpc-1",
+		SubnetName:   "subnet",
+		SubnetID:     "subnet-1",
+		GatewayName:  "gateway",
+		GatewayID:    "igw-1",
+		RouteName:    "route",
+		SGName:       "sg",
+		SGID:         "sg-1",
+		SGRuleName:   "rule",
+		KeyName:      "key",
+		InstanceName: "instance",
+	}
+
+	for _, kind := range []string{"AWSVPC", "AWSSubnet", "AWSGateway", "AWSRoute", "AWSSecurityGroup", "AWSSecurityGroupRule", "AWSKey", "AWSInstance"} {
+		t.Run(kind, func(t *testing.T) {
+			input.Type = kind
+			k, err := LookupKind(CloudAWS, kind)
+			if err != nil {
+				t.Fatalf("LookupKind() error = %v", err)
+			}
+			code, err := k.Code(input)
+			if err != nil {
+				t.Fatalf("Code() error = %v", err)
+			}
+			if err := terranova.NewPlatform(code).Validate(); err != nil {
+				t.Errorf("Code() is not valid. %v\n%s", err, code)
+			}
+			if _, ok := k.Providers()["aws"]; !ok {
+				t.Errorf("Providers() does not include the aws provider")
+			}
+			if addr := k.Address(input); !strings.Contains(code, strings.Replace(strings.Split(addr, "[")[0], ".", `" "`, 1)) {
+				t.Errorf("Address() = %s is not a resource of the code", addr)
+			}
+			if addr := k.ImportAddress(input); addr == "" && kind != "AWSSecurityGroupRule" {
+				t.Errorf("ImportAddress() is empty")
+			}
+			if got := StateSecretName(input); got != "tfstate-"+strings.ToLower(kind)+"-test" {
+				t.Errorf("StateSecretName() = %s", got)
+			}
+		})
+	}
+
+	if _, err := LookupKind(CloudAWS, "AWSGatewy"); err == nil {
+		t.Errorf("LookupKind() expected an error for an unknown kind")
+	}
+}
+
+func TestTemplateKindEscaping(t *testing.T) {
+	k := &templateKind{
+		template: `resource "aws_vpc" "{{ident .NAME}}" {
+	tags = { Name = "{{str .NAME}}", Owner = "{{str .OWNER}}" }
+}
+`,
+		placeholders: func(input TerraVars) map[string]string {
+			return map[string]string{"NAME": input.Name, "OWNER": input.Namespace}
+		},
+	}
+
+	code, err := k.Code(TerraVars{Name: "vpc", Namespace: `x" } resource "aws_vpc" "y" { tags = { a = "${var.secret_key}`})
+	if err != nil {
+		t.Fatalf("Code() error = %v", err)
+	}
+	if !strings.Contains(code, `Owner = "x\" } resource \"aws_vpc\" \"y\" { tags = { a = \"$${var.secret_key}"`) {
+		t.Errorf("Code() did not escape the string:\n%s", code)
+	}
+	if err := terranova.NewPlatform(code).Validate(); err != nil {
+		t.Errorf("Code() is not valid. %v\n%s", err, code)
+	}
+
+	if _, err := k.Code(TerraVars{Name: `vpc" {`}); err == nil {
+		t.Errorf("Code() expected an error for an invalid name")
+	}
+
+	k.placeholders = func(input TerraVars) map[string]string {
+		return map[string]string{"NAME": input.Name}
+	}
+	if _, err := k.Code(TerraVars{Name: "vpc"}); err == nil {
+		t.Errorf("Code() expected an error for an unresolved placeholder")
+	}
+}
+
+func TestSecurityGroupRuleVars(t *testing.T) {
+	input := TerraVars{
+		Name:       "rule",
+		Cloud:      CloudAWS,
+		Type:       "AWSSecurityGroupRule",
+		SGRuleName: "rule",
+		SGID:       "sg-1",
+		SGType:     "ingress",
+		FromPort:   "22",
+		ToPort:     "22",
+		Protocol:   "tcp",
+		SourceSGID: "sg-2",
+	}
+
+	k, err := LookupKind(CloudAWS, input.Type)
+	if err != nil {
+		t.Fatalf("LookupKind() error = %v", err)
+	}
+	code, err := k.Code(input)
+	if err != nil {
+		t.Fatalf("Code() error = %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "rule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := terranova.NewPlatform(code).BindVars(k.Vars(input)).Export(dir); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	vars, err := ioutil.ReadFile(filepath.Join(dir, "terraform.tfvars"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`cidr_blocks              = []`, `from_port                = 22`, `self                     = false`, `source_security_group_id = "sg-2"`} {
+		if !strings.Contains(string(vars), want) {
+			t.Errorf("Export() variables do not contain %s:\n%s", want, vars)
+		}
+	}
+}
+
+func TestInstanceVars(t *testing.T) {
+	input := TerraVars{
+		Name:              "web",
+		Cloud:             CloudAWS,
+		Type:              "AWSInstance",
+		InstanceName:      "web",
+		SubnetID:          "subnet-1",
+		InstanceType:      "t2.micro",
+		ImageID:           "ami-1",
+		InstanceCount:     2,
+		SGIDs:             []string{"sg-1", "sg-2"},
+		RootVolume:        &terraformv1alpha1.AWSVolume{Size: 20},
+		Volumes:           []terraformv1alpha1.AWSVolume{{DeviceName: "/dev/sdh", Size: 100, Type: "gp2", Encrypted: true}},
+		InstanceTags:      map[string]string{"Team": "infra"},
+		AssociatePublicIP: true,
+	}
+
+	k, err := LookupKind(CloudAWS, input.Type)
+	if err != nil {
+		t.Fatalf("LookupKind() error = %v", err)
+	}
+	code, err := k.Code(input)
+	if err != nil {
+		t.Fatalf("Code() error = %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "instance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := terranova.NewPlatform(code).BindVars(k.Vars(input)).Export(dir); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	vars, err := ioutil.ReadFile(filepath.Join(dir, "terraform.tfvars"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`instance_count              = 2`, `security_group_ids          = ["sg-1", "sg-2"]`, `device_name = "/dev/sdh"`, `volume_size = 20`, `Team = "infra"`} {
+		if !strings.Contains(string(vars), want) {
+			t.Errorf("Export() variables do not contain %s:\n%s", want, vars)
+		}
+	}
+}
+
+func TestUserCodeKind(t *testing.T) {
+	input := TerraVars{
+		Name:      "code",
+		Cloud:     CloudAWS,
+		Type:      "HCL",
+		AccessKey: "access",
+		HCLFiles: map[string]string{
+			"main.tf": `variable "cidr" {}
+variable "tags" { type = map(string) }
+resource "aws_vpc" "main" {
+	cidr_block = var.cidr
+	tags       = var.tags
+}
+output "id" { value = aws_vpc.main.id }
+`,
+		},
+		HCLVars: map[string]interface{}{"cidr": "10.0.0.0/16", "tags": json.RawMessage(`{"env":"test"}`), "access_key": "user"},
+	}
+
+	k, err := LookupKind(CloudAWS, input.Type)
+	if err != nil {
+		t.Fatalf("LookupKind() error = %v", err)
+	}
+	code, err := k.Code(input)
+	if err != nil {
+		t.Fatalf("Code() error = %v", err)
+	}
+	platform := terranova.NewPlatform("").AddFile(ProviderFile, code)
+	for path, content := range input.HCLFiles {
+		platform.AddFile(path, content)
+	}
+	if err := platform.Validate(); err != nil {
+		t.Errorf("Code() is not valid with the user code. %v", err)
+	}
+	if addr := k.Address(input); addr != "" {
+		t.Errorf("Address() = %s, want none", addr)
+	}
+
+	vars := k.Vars(input)
+	if vars["cidr"] != "10.0.0.0/16" {
+		t.Errorf("Vars() cidr = %v, want the variable of the user", vars["cidr"])
+	}
+	if _, ok := vars["tags"].(json.RawMessage); !ok {
+		t.Errorf("Vars() tags = %v, want the JSON value of the user", vars["tags"])
+	}
+	if vars["access_key"] != "access" {
+		t.Errorf("Vars() access_key = %v, want the credentials of the provider", vars["access_key"])
+	}
+
+	if _, err := k.Code(TerraVars{Name: "code", Type: "HCL"}); err == nil {
+		t.Errorf("Code() expected an error without code")
+	}
+	if _, err := k.Code(TerraVars{Name: "code", Type: "HCL", HCLStateOnly: true}); err != nil {
+		t.Errorf("Code() error = %v, want the providers only to destroy the state", err)
+	}
+	if _, err := k.Code(TerraVars{Name: "code", Type: "HCL", HCLFiles: map[string]string{ProviderFile: ""}}); err == nil {
+		t.Errorf("Code() expected an error for the file of the provider")
+	}
+	for _, files := range []map[string]string{
+		{"main.tf": `output "token" { value = file("/var/run/secrets/kubernetes.io/serviceaccount/token") }`},
+		{"main.tf": `locals { x = [for f in fileset("/", "*") : f] }`},
+		{"main.tf": `provider "aws" { alias = "other" }`},
+		{"main.tf.json": `{"output": {"token": {"value": "${file(\"/etc/passwd\")}"}}}`},
+		{"main.tf.json": `{"provider": {"aws": {}}}`},
+		{"main.tf": `output "key" { value = var.secret_key }`},
+		{"main.tf": `output "key" { value = "${var.access_key}" }`},
+		{"modules/net/net.tf": `variable "secret_key" {}`},
+		{"main.tf.json": `{"output": {"key": {"value": "${var.secret_key}"}}}`},
+		{"main.tf.json": `{"variable": {"access_key": {}}}`},
+	} {
+		if _, err := k.Code(TerraVars{Name: "code", Type: "HCL", HCLFiles: files}); err == nil {
+			t.Errorf("Code() expected an error for %v", files)
+		}
+	}
+}
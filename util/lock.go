@@ -0,0 +1,326 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+	"github.com/tmax-cloud/terraform-operator/terranova"
+)
+
+const (
+	// LockInfoAnnotation is the Lease annotation holding the lock info as JSON
+	LockInfoAnnotation = "terraform.tmax.io/lock-info"
+
+	// DefaultLockDuration is how long a lock is valid without being renewed
+	DefaultLockDuration = 60 * time.Second
+)
+
+var lockLog = ctrl.Log.WithName("lease-lock")
+
+// LockError is returned when the state is locked by someone else
+type LockError struct {
+	Info *terranova.LockInfo
+
+	// Stale is true when the holder stopped renewing the lock, probably
+	// because it crashed
+	Stale bool
+}
+
+func (e *LockError) Error() string {
+	state := "locked"
+	if e.Stale {
+		state = "locked by a stale lock"
+	}
+	return fmt.Sprintf("state is %s (ID: %s, holder: %s, operation: %s, created: %s). Annotate the resource with %s=%s to release it",
+		state, e.Info.ID, e.Info.Who, e.Info.Operation, e.Info.Created.Format(time.RFC3339), terraformv1alpha1.ForceUnlockAnnotation, e.Info.ID)
+}
+
+// LeaseLock is a terranova.Locker backed by a coordination.k8s.io Lease. The
+// lease is renewed while the lock is held, so a lock whose holder crashed is
+// detected as stale once the lease expires. Stale locks are not taken over,
+// they have to be released with the force-unlock annotation.
+type LeaseLock struct {
+	mu sync.Mutex
+
+	client    client.Client
+	namespace string
+	name      string
+	owner     *metav1.OwnerReference
+	holder    string
+	duration  time.Duration
+
+	id   string
+	stop chan struct{}
+	// lost is why the lock was lost while it was held, if it was
+	lost error
+}
+
+var _ terranova.Locker = (*LeaseLock)(nil)
+
+// NewLeaseLock returns a lock stored in the Lease `name`. If owner is not nil,
+// the Lease is owned by it.
+func NewLeaseLock(c client.Client, namespace, name string, owner *metav1.OwnerReference) *LeaseLock {
+	holder, _ := os.Hostname()
+	return &LeaseLock{
+		client:    c,
+		namespace: namespace,
+		name:      name,
+		owner:     owner,
+		holder:    holder,
+		duration:  DefaultLockDuration,
+	}
+}
+
+// Lock creates the Lease. It fails with a LockError if the Lease already exists
+func (l *LeaseLock) Lock(info *terranova.LockInfo) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info.Who = l.holder
+	data, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(l.duration / time.Second)
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        l.name,
+			Namespace:   l.namespace,
+			Annotations: map[string]string{LockInfoAnnotation: string(data)},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &l.holder,
+			LeaseDurationSeconds: &seconds,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	}
+	if l.owner != nil {
+		lease.OwnerReferences = []metav1.OwnerReference{*l.owner}
+	}
+
+	if err := l.client.Create(context.TODO(), lease); err != nil {
+		if !errors.IsAlreadyExists(err) {
+			return "", err
+		}
+		existing, err := l.getLease()
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return "", fmt.Errorf("lease %s/%s was released while acquiring it, retry", l.namespace, l.name)
+		}
+		lockErr, err := leaseError(existing)
+		if err != nil {
+			return "", err
+		}
+		return "", lockErr
+	}
+
+	l.id = info.ID
+	l.lost = nil
+	l.stop = make(chan struct{})
+	go l.renew(info.ID, l.stop)
+
+	return info.ID, nil
+}
+
+// Unlock stops renewing the Lease and deletes it. It fails if the lock was
+// lost while it was held, the operation it protected may have raced with
+// another one.
+func (l *LeaseLock) Unlock(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.id == "" {
+		return fmt.Errorf("lock %q is not held", id)
+	}
+	if id != l.id {
+		return fmt.Errorf("lock ID %q does not match the held lock %q", id, l.id)
+	}
+
+	close(l.stop)
+	l.stop = nil
+	l.id = ""
+
+	if err := deleteLease(l.client, l.namespace, l.name, id); err != nil && l.lost == nil {
+		return err
+	}
+	if l.lost != nil {
+		return fmt.Errorf("lock %s of lease %s/%s was lost while it was held. %s", id, l.namespace, l.name, l.lost)
+	}
+	return nil
+}
+
+// renew updates the renew time of the Lease until stop is closed. It stops
+// when the lock is lost: the Lease was deleted, taken by another holder or
+// not renewed before it expired.
+func (l *LeaseLock) renew(id string, stop <-chan struct{}) {
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+
+	renewed := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := l.renewLease(id)
+			if err == nil {
+				renewed = time.Now()
+				continue
+			}
+			lockLog.Error(err, "Failed to renew the lease", "namespace", l.namespace, "name", l.name, "LockID", id)
+
+			if _, lost := err.(*lostLockError); lost || time.Since(renewed) > l.duration {
+				l.mu.Lock()
+				l.lost = err
+				l.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// lostLockError is returned when the Lease no longer holds the lock
+type lostLockError struct {
+	reason string
+}
+
+func (e *lostLockError) Error() string {
+	return e.reason
+}
+
+// renewLease updates the renew time of the Lease holding the lock
+func (l *LeaseLock) renewLease(id string) error {
+	lease, err := l.getLease()
+	if err != nil {
+		return err
+	}
+	if lease == nil {
+		return &lostLockError{"the lease was deleted"}
+	}
+	// The lock was force-unlocked, it may be held by someone else now
+	lockErr, err := leaseError(lease)
+	if err != nil {
+		return err
+	}
+	if lockErr.Info.ID != id {
+		return &lostLockError{fmt.Sprintf("the lease is held by the lock %s", lockErr.Info.ID)}
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	return l.client.Update(context.TODO(), lease)
+}
+
+func (l *LeaseLock) getLease() (*coordinationv1.Lease, error) {
+	lease := &coordinationv1.Lease{}
+	err := l.client.Get(context.TODO(), types.NamespacedName{Name: l.name, Namespace: l.namespace}, lease)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return lease, nil
+}
+
+// leaseError returns the LockError describing the lock held in the Lease
+func leaseError(lease *coordinationv1.Lease) (*LockError, error) {
+	info := &terranova.LockInfo{}
+	if err := json.Unmarshal([]byte(lease.Annotations[LockInfoAnnotation]), info); err != nil {
+		return nil, fmt.Errorf("invalid lock info in lease %s/%s. %s", lease.Namespace, lease.Name, err)
+	}
+
+	stale := false
+	if lease.Spec.RenewTime != nil && lease.Spec.LeaseDurationSeconds != nil {
+		expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		stale = time.Now().After(expiry)
+	}
+
+	return &LockError{Info: info, Stale: stale}, nil
+}
+
+// deleteLease deletes the Lease if it holds the lock with the given ID
+func deleteLease(c client.Client, namespace, name, id string) error {
+	lease := &coordinationv1.Lease{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: namespace}, lease)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	lockErr, err := leaseError(lease)
+	if err != nil {
+		return err
+	}
+	if held := lockErr.Info.ID; held != id {
+		return fmt.Errorf("lock ID %q does not match the lock %q of lease %s/%s", id, held, namespace, name)
+	}
+
+	// The preconditions make sure the lease is not replaced in the meantime
+	err = c.Delete(context.TODO(), lease, client.Preconditions{UID: &lease.UID, ResourceVersion: &lease.ResourceVersion})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// ForceUnlock releases the lock of the state of the resource, if it holds the
+// lock with the given ID
+func ForceUnlock(c client.Client, input TerraVars, id string) error {
+	return deleteLease(c, input.Namespace, StateSecretName(input), id)
+}
+
+// ForceUnlockAnnotated releases the lock of the state of the resource requested
+// by its force-unlock annotation, if any. The annotation is removed once the
+// lock is released, the object has to be updated.
+func ForceUnlockAnnotated(c client.Client, input TerraVars, obj metav1.Object, log logr.Logger) {
+	annotations := obj.GetAnnotations()
+	lockID, ok := annotations[terraformv1alpha1.ForceUnlockAnnotation]
+	if !ok {
+		return
+	}
+
+	if err := ForceUnlock(c, input, lockID); err != nil {
+		log.Error(err, "Failed to force-unlock the state", "LockID", lockID)
+		return
+	}
+	log.Info("Released the state lock", "LockID", lockID)
+	delete(annotations, terraformv1alpha1.ForceUnlockAnnotation)
+	obj.SetAnnotations(annotations)
+}
+
+// LockStatus returns the status of the lock blocking the operation, or nil if
+// the error is not a LockError
+func LockStatus(err error) *terraformv1alpha1.LockStatus {
+	lockErr, ok := err.(*LockError)
+	if !ok {
+		return nil
+	}
+	return &terraformv1alpha1.LockStatus{
+		ID:        lockErr.Info.ID,
+		Holder:    lockErr.Info.Who,
+		Operation: lockErr.Info.Operation,
+		Created:   metav1.NewTime(lockErr.Info.Created),
+		Stale:     lockErr.Stale,
+	}
+}
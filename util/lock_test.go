@@ -0,0 +1,91 @@
+package util
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/states/statemgr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLeaseLock(t *testing.T) {
+	c := fake.NewFakeClientWithScheme(scheme.Scheme)
+	input := TerraVars{Name: "vpc", Namespace: "default", Type: "AWSVPC"}
+
+	first := NewLeaseLock(c, input.Namespace, StateSecretName(input), nil)
+	id, err := first.Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	second := NewLeaseLock(c, input.Namespace, StateSecretName(input), nil)
+	_, err = second.Lock(statemgr.NewLockInfo())
+	if status := LockStatus(err); status == nil || status.ID != id || status.Stale {
+		t.Fatalf("Lock() error = %v, want a LockError with ID %s", err, id)
+	}
+
+	// Simulate a holder which stopped renewing the lease
+	lease := &coordinationv1.Lease{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: input.Namespace, Name: StateSecretName(input)}, lease); err != nil {
+		t.Fatalf("failed to get the Lease. %v", err)
+	}
+	expired := metav1.NewMicroTime(time.Now().Add(-2 * DefaultLockDuration))
+	lease.Spec.RenewTime = &expired
+	if err := c.Update(context.TODO(), lease); err != nil {
+		t.Fatalf("failed to update the Lease. %v", err)
+	}
+
+	_, err = second.Lock(statemgr.NewLockInfo())
+	if status := LockStatus(err); status == nil || !status.Stale {
+		t.Fatalf("Lock() error = %v, want a stale LockError", err)
+	}
+
+	if err := ForceUnlock(c, input, "wrong"); err == nil {
+		t.Errorf("ForceUnlock() expected an error releasing a lock with a different ID")
+	}
+	if err := ForceUnlock(c, input, id); err != nil {
+		t.Fatalf("ForceUnlock() error = %v", err)
+	}
+
+	secondID, err := second.Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatalf("Lock() error = %v after force-unlock", err)
+	}
+	if err := second.Unlock(secondID); err != nil {
+		t.Errorf("Unlock() error = %v", err)
+	}
+	if err := second.Unlock(secondID); err == nil {
+		t.Errorf("Unlock() expected an error releasing a lock twice")
+	}
+	if err := NewLeaseLock(c, input.Namespace, "other", nil).Unlock(""); err == nil {
+		t.Errorf("Unlock() expected an error releasing a lock never held")
+	}
+}
+
+func TestLeaseLockLost(t *testing.T) {
+	c := fake.NewFakeClientWithScheme(scheme.Scheme)
+	input := TerraVars{Name: "vpc", Namespace: "default", Type: "AWSVPC"}
+
+	lock := NewLeaseLock(c, input.Namespace, StateSecretName(input), nil)
+	lock.duration = 300 * time.Millisecond
+	id, err := lock.Lock(statemgr.NewLockInfo())
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	// Another operation released the lock while it was held
+	if err := ForceUnlock(c, input, id); err != nil {
+		t.Fatalf("ForceUnlock() error = %v", err)
+	}
+	time.Sleep(lock.duration)
+
+	if err := lock.Unlock(id); err == nil || !strings.Contains(err.Error(), "was lost") {
+		t.Errorf("Unlock() error = %v, want the lock lost", err)
+	}
+}
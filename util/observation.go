@@ -0,0 +1,205 @@
+package util
+
+import (
+	"sort"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/tmax-cloud/terraform-operator/terranova"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Observation is the state of the provisioned cloud resources of a kind
+type Observation struct {
+	// ID of the main resource of the kind
+	ID string
+
+	// Attributes of the main resource of the kind
+	Attributes cty.Value
+
+	// Instances are the attributes of every instance of the main resource,
+	// ordered by index, when it has a count
+	Instances []cty.Value
+
+	// Outputs of the HCL code of the kind
+	Outputs map[string]cty.Value
+
+	// sensitive are the names of the sensitive outputs
+	sensitive map[string]bool
+
+	// resources are the attributes of the other resources of the HCL code,
+	// by resource address
+	resources map[string]cty.Value
+}
+
+// Attribute returns the attribute of the main resource as a string, or "" if
+// it's not set or it's not a primitive value
+func (o *Observation) Attribute(name string) string {
+	if o == nil {
+		return ""
+	}
+	return attribute(o.Attributes, name)
+}
+
+// InstanceAttribute returns the attribute of the i-th instance of the main
+// resource as a string
+func (o *Observation) InstanceAttribute(i int, name string) string {
+	if o == nil || i < 0 || i >= len(o.Instances) {
+		return ""
+	}
+	return attribute(o.Instances[i], name)
+}
+
+// ResourceAttribute returns the attribute of another resource of the HCL code
+// as a string, e.g. ResourceAttribute("tls_private_key.key", "public_key_pem").
+// The first instance of the resource is used when it has a count.
+func (o *Observation) ResourceAttribute(resource, name string) string {
+	if o == nil {
+		return ""
+	}
+	attrs, ok := o.resources[resource]
+	if !ok {
+		return ""
+	}
+	return attribute(attrs, name)
+}
+
+// Output returns the output of the HCL code as a string, or "" if it's not
+// set or it's not a primitive value
+func (o *Observation) Output(name string) string {
+	if o == nil {
+		return ""
+	}
+	value, ok := o.Outputs[name]
+	if !ok {
+		return ""
+	}
+	return primitiveString(value)
+}
+
+// OutputStrings returns the outputs as strings, the values which are not
+// primitive in JSON. The sensitive outputs are left out unless sensitive is
+// true.
+func (o *Observation) OutputStrings(sensitive bool) map[string]string {
+	outputs := map[string]string{}
+	if o == nil {
+		return outputs
+	}
+	for name, value := range o.Outputs {
+		if o.sensitive[name] && !sensitive {
+			continue
+		}
+		if value.IsNull() || !value.IsWhollyKnown() {
+			outputs[name] = ""
+		} else if value.Type().IsPrimitiveType() {
+			outputs[name] = primitiveString(value)
+		} else if data, err := ctyjson.Marshal(value, value.Type()); err == nil {
+			outputs[name] = string(data)
+		}
+	}
+	return outputs
+}
+
+func attribute(attrs cty.Value, name string) string {
+	if !attrs.Type().IsObjectType() || !attrs.Type().HasAttribute(name) {
+		return ""
+	}
+	return primitiveString(attrs.GetAttr(name))
+}
+
+func primitiveString(value cty.Value) string {
+	if value.IsNull() || !value.IsKnown() || !value.Type().IsPrimitiveType() {
+		return ""
+	}
+	value, err := convert.Convert(value, cty.String)
+	if err != nil {
+		return ""
+	}
+	return value.AsString()
+}
+
+// observe returns the observation of the main resource of the kind in the
+// state of the platform
+func observe(platform *terranova.Platform, input TerraVars) (*Observation, error) {
+	kind, err := LookupKind(input.Cloud, input.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	// The kinds of user code have no main resource
+	attrs := cty.EmptyObjectVal
+	address := kind.Address(input)
+	if address != "" {
+		if attrs, err = platform.ResourceAttributes(address); err != nil {
+			return nil, err
+		}
+	}
+
+	obs := &Observation{
+		Attributes: attrs,
+		Outputs:    platform.Outputs(),
+		sensitive:  map[string]bool{},
+		resources:  map[string]cty.Value{},
+	}
+	obs.ID = obs.Attribute("id")
+
+	if platform.State == nil || platform.State.RootModule() == nil {
+		return obs, nil
+	}
+	for name, output := range platform.State.RootModule().OutputValues {
+		obs.sensitive[name] = output.Sensitive
+	}
+	if target, diags := addrs.ParseAbsResourceInstanceStr(address); !diags.HasErrors() {
+		obs.Instances = instances(platform, target.ContainingResource())
+	}
+	for name, resource := range platform.State.RootModule().Resources {
+		for _, key := range []addrs.InstanceKey{addrs.NoKey, addrs.IntKey(0)} {
+			if _, ok := resource.Instances[key]; !ok {
+				continue
+			}
+			if attrs, err := platform.ResourceAttributes(resource.Addr.Instance(key).String()); err == nil {
+				obs.resources[name] = attrs
+			}
+			break
+		}
+	}
+	return obs, nil
+}
+
+// instances returns the attributes of the counted instances of the resource,
+// ordered by index
+func instances(platform *terranova.Platform, addr addrs.AbsResource) []cty.Value {
+	resource := platform.State.Resource(addr)
+	if resource == nil {
+		return nil
+	}
+
+	keys := []int{}
+	for key := range resource.Instances {
+		if index, ok := key.(addrs.IntKey); ok {
+			keys = append(keys, int(index))
+		}
+	}
+	sort.Ints(keys)
+
+	values := []cty.Value{}
+	for _, key := range keys {
+		if attrs, err := platform.ResourceAttributes(addr.Instance(addrs.IntKey(key)).String()); err == nil {
+			values = append(values, attrs)
+		}
+	}
+	return values
+}
+
+// Observe Terraform (Go Package)
+// Returns the observation of the provisioned remote resource, as recorded in
+// its state
+func ObserveTerraform(c client.Client, input TerraVars) (*Observation, error) {
+	platform, _, err := newPlatform(c, input)
+	if err != nil {
+		return nil, err
+	}
+	return observe(platform, input)
+}
@@ -0,0 +1,130 @@
+package util
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/states"
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+	"github.com/zclconf/go-cty/cty"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestObserveTerraform(t *testing.T) {
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"accessKey": []byte("access"), "secretKey": []byte("secret")},
+	}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme, credentials)
+	input := TerraVars{
+		Name:                 "main",
+		Namespace:            "default",
+		Type:                 "AWSVPC",
+		Cloud:                CloudAWS,
+		VPCName:              "main",
+		CredentialsSecretRef: &terraformv1alpha1.CredentialsSecretRef{Name: credentials.Name},
+	}
+
+	// The state of the VPC, with the TLS key of another resource listed after it
+	state := newResourceState("key")
+	state.RootModule().SetResourceInstanceCurrent(
+		addrs.Resource{Mode: addrs.ManagedResourceMode, Type: "aws_vpc", Name: "main"}.Instance(addrs.NoKey),
+		&states.ResourceInstanceObjectSrc{
+			Status:    states.ObjectReady,
+			AttrsJSON: []byte(`{"id":"vpc-1","arn":"arn:aws:ec2:vpc/vpc-1","enable_dns_support":true,"tags":{"Name":"main"}}`),
+		},
+		addrs.ProviderConfig{Type: addrs.NewLegacyProvider("aws")}.Absolute(addrs.RootModuleInstance),
+	)
+	state.RootModule().SetOutputValue("private_key_pem", cty.StringVal("PRIVATE KEY"), true)
+
+	secretState := NewSecretState(c, input.Namespace, StateSecretName(input), nil)
+	secretState.RefreshState()
+	secretState.WriteState(state)
+	if err := secretState.PersistState(); err != nil {
+		t.Fatalf("PersistState() error = %v", err)
+	}
+
+	obs, err := ObserveTerraform(c, input)
+	if err != nil {
+		t.Fatalf("ObserveTerraform() error = %v", err)
+	}
+	if obs.ID != "vpc-1" {
+		t.Errorf("ObserveTerraform() ID = %s, want vpc-1", obs.ID)
+	}
+	for name, want := range map[string]string{"arn": "arn:aws:ec2:vpc/vpc-1", "enable_dns_support": "true", "tags": "", "missing": ""} {
+		if got := obs.Attribute(name); got != want {
+			t.Errorf("Attribute(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if got := obs.ResourceAttribute("aws_vpc.key", "id"); got != "key" {
+		t.Errorf("ResourceAttribute() = %q, want the ID of the other resource", got)
+	}
+	if got := obs.Output("private_key_pem"); got != "PRIVATE KEY" {
+		t.Errorf("Output() = %q, want the private key", got)
+	}
+	if _, ok := obs.OutputStrings(false)["private_key_pem"]; ok {
+		t.Errorf("OutputStrings(false) includes the sensitive output")
+	}
+	if got := obs.OutputStrings(true)["private_key_pem"]; got != "PRIVATE KEY" {
+		t.Errorf("OutputStrings(true) = %q, want the private key", got)
+	}
+}
+
+func TestObserveInstances(t *testing.T) {
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"accessKey": []byte("access"), "secretKey": []byte("secret")},
+	}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme, credentials)
+	input := TerraVars{
+		Name:                 "web",
+		Namespace:            "default",
+		Type:                 "AWSInstance",
+		Cloud:                CloudAWS,
+		InstanceName:         "web",
+		CredentialsSecretRef: &terraformv1alpha1.CredentialsSecretRef{Name: credentials.Name},
+	}
+
+	// The replicas are listed out of order in the state
+	state := states.NewState()
+	for _, i := range []int{1, 0} {
+		state.RootModule().SetResourceInstanceCurrent(
+			addrs.Resource{Mode: addrs.ManagedResourceMode, Type: "aws_instance", Name: "web"}.Instance(addrs.IntKey(i)),
+			&states.ResourceInstanceObjectSrc{
+				Status:    states.ObjectReady,
+				AttrsJSON: []byte(fmt.Sprintf(`{"id":"i-%d","private_ip":"10.0.0.%d"}`, i, i)),
+			},
+			addrs.ProviderConfig{Type: addrs.NewLegacyProvider("aws")}.Absolute(addrs.RootModuleInstance),
+		)
+	}
+
+	secretState := NewSecretState(c, input.Namespace, StateSecretName(input), nil)
+	secretState.RefreshState()
+	secretState.WriteState(state)
+	if err := secretState.PersistState(); err != nil {
+		t.Fatalf("PersistState() error = %v", err)
+	}
+
+	obs, err := ObserveTerraform(c, input)
+	if err != nil {
+		t.Fatalf("ObserveTerraform() error = %v", err)
+	}
+	if obs.ID != "i-0" {
+		t.Errorf("ObserveTerraform() ID = %s, want the first instance", obs.ID)
+	}
+	if len(obs.Instances) != 2 {
+		t.Fatalf("ObserveTerraform() Instances = %d, want 2", len(obs.Instances))
+	}
+	for i := range obs.Instances {
+		if got, want := obs.InstanceAttribute(i, "private_ip"), fmt.Sprintf("10.0.0.%d", i); got != want {
+			t.Errorf("InstanceAttribute(%d) = %q, want %q", i, got, want)
+		}
+	}
+	if got := obs.InstanceAttribute(2, "id"); got != "" {
+		t.Errorf("InstanceAttribute() = %q for a missing instance", got)
+	}
+}
@@ -0,0 +1,113 @@
+package util
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+)
+
+// Default Secret keys of the provider credentials
+const (
+	AWSAccessKeyKey = "accessKey"
+	AWSSecretKeyKey = "secretKey"
+
+	AzureSubscriptionIDKey = "subscriptionID"
+	AzureClientIDKey       = "clientID"
+	AzureClientSecretKey   = "clientSecret"
+	AzureTenantIDKey       = "tenantID"
+)
+
+// ProviderVars returns the TerraVars with the provider of the resource. The
+// credentials are not copied, they're read from the Secret when Terraform is
+// executed.
+func ProviderVars(input TerraVars, provider *terraformv1alpha1.Provider) TerraVars {
+	output := input
+
+	output.ProviderName = provider.Name
+	output.Cloud = provider.Spec.Cloud
+	output.Region = provider.Spec.Region
+	output.CredentialsSecretRef = provider.Spec.CredentialsSecretRef
+
+	return output
+}
+
+// HasInlineCredentials returns true if the provider still has the deprecated
+// inline credentials
+func HasInlineCredentials(provider *terraformv1alpha1.Provider) bool {
+	return provider.Spec.AWS != (terraformv1alpha1.AWSSpec{}) || provider.Spec.Azure != (terraformv1alpha1.AzureSpec{})
+}
+
+// CredentialsSecretForProvider returns a Secret holding the inline credentials
+// of the provider, with the default keys
+func CredentialsSecretForProvider(provider *terraformv1alpha1.Provider) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      provider.Name + "-credentials",
+			Namespace: provider.Namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			AWSAccessKeyKey:        provider.Spec.AWS.AccessKey,
+			AWSSecretKeyKey:        provider.Spec.AWS.SecretKey,
+			AzureSubscriptionIDKey: provider.Spec.Azure.SubscriptionID,
+			AzureClientIDKey:       provider.Spec.Azure.ClientID,
+			AzureClientSecretKey:   provider.Spec.Azure.ClientSecret,
+			AzureTenantIDKey:       provider.Spec.Azure.TenantID,
+		},
+	}
+}
+
+// resolveCredentials returns the TerraVars with the credentials read from the
+// Secret of the provider
+func resolveCredentials(c client.Client, input TerraVars) (TerraVars, error) {
+	output := input
+
+	ref := input.CredentialsSecretRef
+	if ref == nil {
+		return output, fmt.Errorf("provider %s has no credentialsSecretRef", input.ProviderName)
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: ref.Name, Namespace: input.Namespace}, secret); err != nil {
+		return output, fmt.Errorf("failed to get the credentials of provider %s. %s", input.ProviderName, err)
+	}
+
+	var err error
+	value := func(key, defaultKey string) string {
+		if key == "" {
+			key = defaultKey
+		}
+		data, ok := secret.Data[key]
+		if !ok && err == nil {
+			err = fmt.Errorf("key %q not found in the credentials Secret %s/%s", key, secret.Namespace, secret.Name)
+		}
+		return string(data)
+	}
+
+	switch input.Cloud {
+	case CloudAWS:
+		keys := terraformv1alpha1.AWSCredentialKeys{}
+		if ref.AWS != nil {
+			keys = *ref.AWS
+		}
+		output.AccessKey = value(keys.AccessKey, AWSAccessKeyKey)
+		output.SecretKey = value(keys.SecretKey, AWSSecretKeyKey)
+	case CloudAzure:
+		keys := terraformv1alpha1.AzureCredentialKeys{}
+		if ref.Azure != nil {
+			keys = *ref.Azure
+		}
+		output.SubscriptionID = value(keys.SubscriptionID, AzureSubscriptionIDKey)
+		output.ClientID = value(keys.ClientID, AzureClientIDKey)
+		output.ClientSecret = value(keys.ClientSecret, AzureClientSecretKey)
+		output.TenantID = value(keys.TenantID, AzureTenantIDKey)
+	}
+
+	return output, err
+}
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+)
+
+func TestResolveCredentials(t *testing.T) {
+	c := fake.NewFakeClientWithScheme(scheme.Scheme)
+	c.Create(context.TODO(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws", Namespace: "default"},
+		Data: map[string][]byte{
+			"accessKey": []byte("AK"),
+			"secretKey": []byte("SK"),
+			"id":        []byte("AK2"),
+		},
+	})
+
+	tests := []struct {
+		name    string
+		ref     *terraformv1alpha1.CredentialsSecretRef
+		wantAK  string
+		wantErr bool
+	}{
+		{"default keys", &terraformv1alpha1.CredentialsSecretRef{Name: "aws"}, "AK", false},
+		{"mapped keys", &terraformv1alpha1.CredentialsSecretRef{Name: "aws", AWS: &terraformv1alpha1.AWSCredentialKeys{AccessKey: "id"}}, "AK2", false},
+		{"missing key", &terraformv1alpha1.CredentialsSecretRef{Name: "aws", AWS: &terraformv1alpha1.AWSCredentialKeys{SecretKey: "secret"}}, "", true},
+		{"missing secret", &terraformv1alpha1.CredentialsSecretRef{Name: "gcp"}, "", true},
+		{"no reference", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := TerraVars{Namespace: "default", Cloud: CloudAWS, CredentialsSecretRef: tt.ref}
+			got, err := resolveCredentials(c, input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveCredentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.AccessKey != tt.wantAK {
+				t.Errorf("resolveCredentials() AccessKey = %s, want %s", got.AccessKey, tt.wantAK)
+			}
+		})
+	}
+}
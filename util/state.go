@@ -0,0 +1,366 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/states/statefile"
+	"github.com/hashicorp/terraform/states/statemgr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+)
+
+const (
+	// StateDataKey is the Secret key holding a (gzipped) chunk of the Terraform state
+	StateDataKey = "tfstate"
+
+	// Annotations of the primary state Secret
+	StateSerialAnnotation  = "terraform.tmax.io/state-serial"
+	StateLineageAnnotation = "terraform.tmax.io/state-lineage"
+	StateChunksAnnotation  = "terraform.tmax.io/state-chunks"
+
+	// A Secret can not be larger than 1MiB, keep some room for the metadata
+	maxStateChunkSize = 900 * 1024
+)
+
+// SecretState is a Terraform state manager (statemgr.Full) which keeps the state
+// in Kubernetes Secrets, so it survives restarts of the operator and can be
+// shared between replicas. The state is gzipped and split into several Secrets
+// when it does not fit into a single one.
+type SecretState struct {
+	mu sync.Mutex
+
+	client    client.Client
+	namespace string
+	name      string
+	owner     *metav1.OwnerReference
+
+	lineage          string
+	serial           uint64
+	state, readState *states.State
+}
+
+var _ statemgr.Full = (*SecretState)(nil)
+
+// NewSecretState returns a state manager storing the state in the Secret `name`.
+// If owner is not nil, every Secret holding the state is owned by it.
+func NewSecretState(c client.Client, namespace, name string, owner *metav1.OwnerReference) *SecretState {
+	return &SecretState{
+		client:    c,
+		namespace: namespace,
+		name:      name,
+		owner:     owner,
+	}
+}
+
+// StateSecretName returns the name of the Secret holding the state of the resource
+func StateSecretName(input TerraVars) string {
+	return strings.ToLower("tfstate-" + input.Type + "-" + input.Name)
+}
+
+// StateOwner returns the owner reference of the state Secret, the resource itself
+func StateOwner(input TerraVars) *metav1.OwnerReference {
+	if input.UID == "" {
+		return nil
+	}
+	return &metav1.OwnerReference{
+		APIVersion: terraformv1alpha1.GroupVersion.String(),
+		Kind:       input.Type,
+		Name:       input.Name,
+		UID:        types.UID(input.UID),
+	}
+}
+
+// State returns the latest state snapshot
+func (s *SecretState) State() *states.State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state.DeepCopy()
+}
+
+// WriteState updates the transient state. It's saved into the Secret by PersistState
+func (s *SecretState) WriteState(state *states.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = state.DeepCopy()
+	return nil
+}
+
+// RefreshState reads the latest state snapshot from the Secret
+func (s *SecretState) RefreshState() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refreshState()
+}
+
+func (s *SecretState) refreshState() error {
+	primary, err := s.getSecret(s.name)
+	if err != nil {
+		return err
+	}
+	if primary == nil {
+		s.readState = nil
+		s.lineage = ""
+		s.serial = 0
+		return nil
+	}
+
+	data, err := s.readChunks(primary)
+	if err != nil {
+		return err
+	}
+
+	sf, err := statefile.Read(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to read the state from Secret %s/%s. %s", s.namespace, s.name, err)
+	}
+
+	s.lineage = sf.Lineage
+	s.serial = sf.Serial
+	s.state = sf.State
+	s.readState = s.state.DeepCopy()
+	return nil
+}
+
+// PersistState saves the transient state into the Secret. It fails if the stored
+// state has a different lineage or has been updated since it was read.
+func (s *SecretState) PersistState() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.readState != nil && statefile.StatesMarshalEqual(s.state, s.readState) {
+		return nil
+	}
+
+	primary, err := s.getSecret(s.name)
+	if err != nil {
+		return err
+	}
+
+	if primary != nil {
+		lineage := primary.Annotations[StateLineageAnnotation]
+		serial, _ := strconv.ParseUint(primary.Annotations[StateSerialAnnotation], 10, 64)
+
+		if s.lineage == "" {
+			return fmt.Errorf("state Secret %s/%s already exists with lineage %q, refresh the state before persisting it", s.namespace, s.name, lineage)
+		}
+		if lineage != s.lineage {
+			return fmt.Errorf("state lineage mismatch in Secret %s/%s: stored %q, expected %q", s.namespace, s.name, lineage, s.lineage)
+		}
+		if serial != s.serial {
+			return fmt.Errorf("state in Secret %s/%s was modified since it was read: stored serial %d, read serial %d", s.namespace, s.name, serial, s.serial)
+		}
+	}
+
+	// The serial and lineage are only updated once the state is written, so
+	// a failed write can be retried
+	lineage, serial := s.lineage, s.serial+1
+	if primary == nil {
+		lineage, serial = statemgr.NewLineage(), 0
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := statefile.Write(statefile.New(s.state, lineage, serial), zw); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if err := s.writeChunks(primary, lineage, serial, buf.Bytes()); err != nil {
+		return err
+	}
+
+	s.lineage, s.serial = lineage, serial
+	s.readState = s.state.DeepCopy()
+	return nil
+}
+
+// Lock is a no-op, the Secret resource version protects the state from
+// concurrent writes
+func (s *SecretState) Lock(info *statemgr.LockInfo) (string, error) {
+	return "", nil
+}
+
+// Unlock is a no-op
+func (s *SecretState) Unlock(id string) error {
+	return nil
+}
+
+// Delete removes all the Secrets holding the state
+func (s *SecretState) Delete() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	primary, err := s.getSecret(s.name)
+	if err != nil || primary == nil {
+		return err
+	}
+
+	for _, name := range chunkNames(primary) {
+		if err := s.deleteSecret(name); err != nil {
+			return err
+		}
+	}
+	if err := s.deleteSecret(s.name); err != nil {
+		return err
+	}
+
+	s.readState = nil
+	s.lineage = ""
+	s.serial = 0
+	return nil
+}
+
+// readChunks returns the uncompressed state stored in the primary Secret and
+// its chunks
+func (s *SecretState) readChunks(primary *corev1.Secret) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(primary.Data[StateDataKey])
+
+	for _, name := range chunkNames(primary) {
+		chunk, err := s.getSecret(name)
+		if err != nil {
+			return nil, err
+		}
+		if chunk == nil {
+			return nil, fmt.Errorf("state chunk %s/%s not found", s.namespace, name)
+		}
+		buf.Write(chunk.Data[StateDataKey])
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress the state from Secret %s/%s. %s", s.namespace, s.name, err)
+	}
+	defer zr.Close()
+
+	return ioutil.ReadAll(zr)
+}
+
+// writeChunks splits the data into chunks, saves them and updates the primary
+// Secret to point to the new chunks. The chunks of the previous serial are
+// removed once the primary Secret has been updated.
+func (s *SecretState) writeChunks(primary *corev1.Secret, lineage string, serial uint64, data []byte) error {
+	var chunks [][]byte
+	for len(data) > maxStateChunkSize {
+		chunks = append(chunks, data[:maxStateChunkSize])
+		data = data[maxStateChunkSize:]
+	}
+	chunks = append(chunks, data)
+
+	var names []string
+	for i, chunk := range chunks[1:] {
+		name := fmt.Sprintf("%s-%d-%d", s.name, serial, i+1)
+		existing, err := s.getSecret(name)
+		if err != nil {
+			return err
+		}
+
+		// A chunk with the same name is a leftover of a failed write of this serial
+		secret := s.newSecret(name, chunk)
+		if existing == nil {
+			err = s.client.Create(context.TODO(), secret)
+		} else {
+			secret.ResourceVersion = existing.ResourceVersion
+			err = s.client.Update(context.TODO(), secret)
+		}
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	secret := s.newSecret(s.name, chunks[0])
+	secret.Annotations = map[string]string{
+		StateSerialAnnotation:  strconv.FormatUint(serial, 10),
+		StateLineageAnnotation: lineage,
+		StateChunksAnnotation:  strings.Join(names, ","),
+	}
+
+	if primary == nil {
+		return s.client.Create(context.TODO(), secret)
+	}
+
+	// The resource version makes the update fail if the Secret was modified
+	// since it was read
+	secret.ResourceVersion = primary.ResourceVersion
+	if err := s.client.Update(context.TODO(), secret); err != nil {
+		return err
+	}
+
+	for _, name := range chunkNames(primary) {
+		if err := s.deleteSecret(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SecretState) newSecret(name string, data []byte) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			StateDataKey: data,
+		},
+	}
+	if s.owner != nil {
+		secret.OwnerReferences = []metav1.OwnerReference{*s.owner}
+	}
+	return secret
+}
+
+// getSecret returns the Secret with the given name, or nil if it does not exist
+func (s *SecretState) getSecret(name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := s.client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: s.namespace}, secret)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return secret, nil
+}
+
+func (s *SecretState) deleteSecret(name string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.namespace,
+		},
+	}
+	if err := s.client.Delete(context.TODO(), secret); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// chunkNames returns the names of the Secrets holding the rest of the state
+func chunkNames(primary *corev1.Secret) []string {
+	chunks := primary.Annotations[StateChunksAnnotation]
+	if chunks == "" {
+		return nil
+	}
+	return strings.Split(chunks, ",")
+}
@@ -0,0 +1,146 @@
+package util
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/states"
+	"github.com/zclconf/go-cty/cty"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestState returns a state with an output of the given size of random
+// (incompressible) data
+func newTestState(size int) *states.State {
+	data := make([]byte, size/2)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+
+	state := states.NewState()
+	state.RootModule().SetOutputValue("data", cty.StringVal(hex.EncodeToString(data)), false)
+	return state
+}
+
+func TestSecretStatePersist(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		minChunks int
+	}{
+		{"small state", 1024, 0},
+		{"state larger than a secret", 4 * maxStateChunkSize, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewFakeClientWithScheme(scheme.Scheme)
+			want := newTestState(tt.size)
+
+			s := NewSecretState(c, "default", "tfstate", nil)
+			if err := s.RefreshState(); err != nil {
+				t.Fatalf("RefreshState() error = %v", err)
+			}
+			if err := s.WriteState(want); err != nil {
+				t.Fatalf("WriteState() error = %v", err)
+			}
+			if err := s.PersistState(); err != nil {
+				t.Fatalf("PersistState() error = %v", err)
+			}
+
+			primary := &corev1.Secret{}
+			if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "tfstate"}, primary); err != nil {
+				t.Fatalf("failed to get the state Secret. %v", err)
+			}
+			if got := len(chunkNames(primary)); got < tt.minChunks {
+				t.Errorf("PersistState() stored %d chunks, want at least %d", got, tt.minChunks)
+			}
+
+			got := NewSecretState(c, "default", "tfstate", nil)
+			if err := got.RefreshState(); err != nil {
+				t.Fatalf("RefreshState() error = %v", err)
+			}
+			if !got.State().Equal(want) {
+				t.Errorf("RefreshState() returned a different state than the persisted one")
+			}
+		})
+	}
+}
+
+func TestSecretStateConflict(t *testing.T) {
+	c := fake.NewFakeClientWithScheme(scheme.Scheme)
+
+	first := NewSecretState(c, "default", "tfstate", nil)
+	first.RefreshState()
+	first.WriteState(newTestState(64))
+	if err := first.PersistState(); err != nil {
+		t.Fatalf("PersistState() error = %v", err)
+	}
+
+	t.Run("modified since it was read", func(t *testing.T) {
+		stale := NewSecretState(c, "default", "tfstate", nil)
+		stale.RefreshState()
+
+		first.WriteState(newTestState(128))
+		if err := first.PersistState(); err != nil {
+			t.Fatalf("PersistState() error = %v", err)
+		}
+
+		stale.WriteState(newTestState(256))
+		err := stale.PersistState()
+		if err == nil || !strings.Contains(err.Error(), "was modified since it was read") {
+			t.Errorf("PersistState() error = %v, want a serial conflict", err)
+		}
+	})
+
+	t.Run("failed write", func(t *testing.T) {
+		retry := NewSecretState(failingClient{c}, "default", "tfstate", nil)
+		retry.RefreshState()
+		retry.WriteState(newTestState(96))
+		if err := retry.PersistState(); err == nil {
+			t.Fatalf("PersistState() expected the write error")
+		}
+
+		retry.client = c
+		if err := retry.PersistState(); err != nil {
+			t.Errorf("PersistState() error = %v retrying a failed write", err)
+		}
+	})
+
+	t.Run("never read", func(t *testing.T) {
+		blind := NewSecretState(c, "default", "tfstate", nil)
+		blind.WriteState(newTestState(512))
+		if err := blind.PersistState(); err == nil {
+			t.Errorf("PersistState() expected an error overwriting a state never read")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := first.Delete(); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		list := &corev1.SecretList{}
+		c.List(context.TODO(), list)
+		if len(list.Items) != 0 {
+			t.Errorf("Delete() left %d Secrets", len(list.Items))
+		}
+	})
+}
+
+// failingClient fails the writes
+type failingClient struct {
+	client.Client
+}
+
+func (c failingClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	return fmt.Errorf("create failed")
+}
+
+func (c failingClient) Update(ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	return fmt.Errorf("update failed")
+}
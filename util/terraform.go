@@ -1,23 +1,23 @@
 package util
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/plans"
-	"github.com/prometheus/common/log"
-	"github.com/terraform-providers/terraform-provider-aws/aws"
-	"github.com/terraform-providers/terraform-provider-tls/tls"
+	"github.com/hashicorp/terraform/states"
+	"github.com/hashicorp/terraform/states/statemgr"
 	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
 	"github.com/tmax-cloud/terraform-operator/terranova"
-	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // Terraform HCL Input Parameters Structure
@@ -26,6 +26,7 @@ type TerraVars struct {
 	Name      string
 	Namespace string
 	Type      string
+	UID       string
 	/*
 		AWS_VPC     AWS_VPC
 		AWS_SUBNET  AWS_SUBNET
@@ -38,6 +39,8 @@ type TerraVars struct {
 	ProviderName string
 	Cloud        string
 	Region       string
+	// Credentials of the provider, resolved from this Secret when Terraform is executed
+	CredentialsSecretRef *terraformv1alpha1.CredentialsSecretRef
 	// AWS Field
 	AccessKey string
 	SecretKey string
@@ -72,23 +75,52 @@ type TerraVars struct {
 	SGName string
 
 	/* AWSSecurityGroupRule */
-	SGRuleID   string
-	SGRuleName string
-	SGType     string
-	FromPort   string
-	ToPort     string
-	Protocol   string
-	SGCIDR     string
+	SGRuleID      string
+	SGRuleName    string
+	SGType        string
+	FromPort      string
+	ToPort        string
+	Protocol      string
+	SGCIDRs       []string
+	SGIPv6CIDRs   []string
+	SourceSGName  string
+	SourceSGID    string
+	SGSelf        bool
+	SGDescription string
 
 	/* AWSKey */
-	KeyID   string
-	KeyName string
+	KeyID        string
+	KeyName      string
+	PublicKey    string
+	KeyAlgorithm string
+	KeySize      int
 
 	/* AWSInstance */
-	InstanceID   string
-	InstanceName string
-	InstanceType string
-	ImageID      string
+	InstanceID         string
+	InstanceName       string
+	InstanceType       string
+	ImageID            string
+	InstanceCount      int
+	SGNames            []string
+	SGIDs              []string
+	UserData           string
+	RootVolume         *terraformv1alpha1.AWSVolume
+	Volumes            []terraformv1alpha1.AWSVolume
+	InstanceTags       map[string]string
+	IAMInstanceProfile string
+	AssociatePublicIP  bool
+	PrivateIP          string
+
+	/* HCL */
+	// HCLFiles are the files of the code supplied by the user, by path
+	HCLFiles map[string]string
+	// HCLVars are the values of the variables declared in HCLFiles
+	HCLVars map[string]interface{}
+	// HCLRootModule is the directory of HCLFiles holding the root module
+	HCLRootModule string
+	// HCLStateOnly destroys the resources of the state without HCLFiles, with
+	// the providers only, when the code is no longer available
+	HCLStateOnly bool
 
 	/* Network */
 	NetworkName string
@@ -143,114 +175,10 @@ type AWS_SG_RULE struct {
 	CIDR     string `json:"cidr,omitempty"`
 }
 
-// ConfigmapToVars returns a Terraform Variable Struct
-func ConfigmapToVars(cm *corev1.ConfigMap) TerraVars {
-
-	configMapData := cm.Data
-
-	output := TerraVars{
-		Name:      configMapData["Name"],
-		Namespace: configMapData["Namespace"],
-		Type:      configMapData["Type"],
-
-		ProviderName:   configMapData["ProviderName"],
-		Cloud:          configMapData["Cloud"],
-		Region:         configMapData["Region"],
-		AccessKey:      configMapData["AccessKey"],
-		SecretKey:      configMapData["SecretKey"],
-		SubscriptionID: configMapData["SubscriptionID"],
-		ClientID:       configMapData["ClientID"],
-		ClientSecret:   configMapData["ClientSecret"],
-		TenantID:       configMapData["TenantID"],
-
-		VPCID:   configMapData["VPCID"],
-		VPCName: configMapData["VPCName"],
-		VPCCIDR: configMapData["VPCCIDR"],
-
-		SubnetID:   configMapData["SubnetID"],
-		SubnetName: configMapData["SubnetName"],
-		SubnetCIDR: configMapData["SubnetCIDR"],
-		Zone:       configMapData["Zone"],
-
-		RouteID:   configMapData["RouteID"],
-		RouteName: configMapData["RouteName"],
-		RouteCIDR: configMapData["RouteCIDR"],
-
-		GatewayID:   configMapData["GatewayID"],
-		GatewayName: configMapData["GatewayName"],
-
-		SGID:   configMapData["SGID"],
-		SGName: configMapData["SGName"],
-
-		SGRuleID:   configMapData["SGRuleID"],
-		SGRuleName: configMapData["SGRuleName"],
-		SGType:     configMapData["SGType"],
-		FromPort:   configMapData["FromPort"],
-		ToPort:     configMapData["ToPort"],
-		Protocol:   configMapData["Protocol"],
-		SGCIDR:     configMapData["SGCIDR"],
-
-		KeyID:   configMapData["KeyID"],
-		KeyName: configMapData["KeyName"],
-
-		InstanceID:   configMapData["InstanceID"],
-		InstanceName: configMapData["InstanceName"],
-		InstanceType: configMapData["InstanceType"],
-		ImageID:      configMapData["ImageID"],
-	}
-
-	/*
-		output := TerraVars{
-			Namespace: configMapData["Namespace"],
-
-			ProviderName:   configMapData["ProviderName"],
-			Cloud:          configMapData["Cloud"],
-			AccessKey:      configMapData["AccessKey"],
-			SecretKey:      configMapData["SecretKey"],
-			Region:         configMapData["Region"],
-			SubscriptionID: configMapData["SubscriptionID"],
-			ClientID:       configMapData["ClientID"],
-			ClientSecret:   configMapData["ClientSecret"],
-			TenantID:       configMapData["TenantID"],
-
-			NetworkName: configMapData["NetworkName"],
-			VPCCIDR:     configMapData["VPCCIDR"],
-			SubnetCIDR:  configMapData["SubnetCIDR"],
-			RouteCIDR:   configMapData["RouteCIDR"],
-		}
-	*/
-	return output
-}
-
 type Params struct {
 	AWSVPC *terraformv1alpha1.AWSVPC
 }
 
-// ConfigmapForResource returns a ConfigMap object
-func ConfigmapForResource(input TerraVars) *corev1.ConfigMap {
-
-	configMapData := make(map[string]string, 0)
-
-	e := reflect.ValueOf(&input).Elem()
-
-	for i := 0; i < e.NumField(); i++ {
-		varName := e.Type().Field(i).Name
-		//varType := e.Type().Field(i).Type
-		varValue := fmt.Sprintf("%v", e.Field(i).Interface())
-
-		configMapData[varName] = varValue
-	}
-
-	cm := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      input.Name,
-			Namespace: input.Namespace,
-		},
-		Data: configMapData,
-	}
-	return cm
-}
-
 // SearchResourceID returns a ConfigMap object
 /*
 func SearchResourceID(input TerraVars) TerraVars {
@@ -275,453 +203,162 @@ func SearchResourceID(input TerraVars) TerraVars {
 }
 */
 
-// ReadIDFromFile returns a Cloud Resource ID from Terraform State File
-func ReadIDFromFile(filename string) (string, error) {
-	var matched string // line with id
-	var id string
-
-	input, err := ioutil.ReadFile(filename)
+// newPlatform returns the platform of the resource kind registered for the
+// input, with its state stored in Secrets owned by the resource and locked by
+// a Lease
+func newPlatform(c client.Client, input TerraVars) (*terranova.Platform, *SecretState, error) {
+	kind, err := LookupKind(input.Cloud, input.Type)
 	if err != nil {
-		log.Error(err, "Failed to read Terraform State File")
-		return "", err
-	}
-
-	lines := strings.Split(string(input), "\n")
-
-	for i, line := range lines {
-		if strings.Contains(line, "\"id\"") {
-			matched = lines[i]
-		}
+		return nil, nil, err
 	}
 
-	t := strings.Split(matched, "\"")
-
-	if len(t) >= 4 {
-		id = t[3]
-	} else {
-		err = errors.New("Index out of range")
-		return "", err
+	input, err = resolveCredentials(c, input)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return id, nil
-}
-
-// plan Terraform (Go Package)
-func PlanTerraform(input TerraVars) (string, error) {
-	var platform *terranova.Platform // Platform is the platform to be managed by Terraform
-	var code string                  // HCL (Hashicorp Configuration Language)
-	var filename string
-	var err error
-
-	var plan *plans.Plan
-	var stats *terranova.Stats
-	var status string
+	name := StateSecretName(input)
+	state := NewSecretState(c, input.Namespace, name, StateOwner(input))
+	lock := NewLeaseLock(c, input.Namespace, name, StateOwner(input))
 
 	/*
 		platform, err = terranova.NewPlatform(code). 		// HCL 코드 기반으로 Platform 초기화 (Default Variable)
 		AddProvider("aws", aws.Provider()).					// Provider 추가 (e.g. AWS, Azure, TLS 등)
 		Var("access_key", input.AccessKey).					// HCL 코드 내 변수 설정
-		PersistStateToFile(input.NetworkName + ".tfstate") 	// Terraform State File 설정
+		PersistStateTo(state) 								// Terraform State 설정
 		...
 		platform.Apply(destroy) 							// 설정된 Context 내용 기반으로 클라우드 리소스 생성/삭제 수행
 	*/
+	code, err := kind.Code(input)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// Define the platform corrensponding to Cloud - Resource type
-	if input.Cloud == "AWS" { // Platform : AWS
-		if input.Type == "AWSVPC" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_VPC_TEMPLATE
-			code = strings.Replace(code, "{{VPC_NAME}}", input.VPCName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.VPCName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				Var("vpc_cidr", input.VPCCIDR).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSSubnet" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_SUBNET_TEMPLATE
-			code = strings.Replace(code, "{{SUBNET_NAME}}", input.SubnetName, -1)
-			code = strings.Replace(code, "{{VPC_ID}}", input.VPCID, -1)
-			//code = strings.Replace(code, "{{VPC_NAME}}", input.VPCName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.SubnetName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				Var("subnet_cidr", input.SubnetCIDR).
-				Var("zone", input.Zone).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSGatewy" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_GATEWAY_TEMPLATE
-			code = strings.Replace(code, "{{GATEWAY_NAME}}", input.GatewayName, -1)
-			code = strings.Replace(code, "{{VPC_ID}}", input.VPCID, -1)
-			//code = strings.Replace(code, "{{VPC_NAME}}", input.VPCName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.GatewayName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSRoute" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_ROUTE_TEMPLATE
-			code = strings.Replace(code, "{{ROUTE_NAME}}", input.RouteName, -1)
-			code = strings.Replace(code, "{{VPC_ID}}", input.VPCID, -1)
-			code = strings.Replace(code, "{{GATEWAY_ID}}", input.GatewayID, -1)
-			code = strings.Replace(code, "{{SUBNET_ID}}", input.SubnetID, -1)
-			//code = strings.Replace(code, "{{VPC_NAME}}", input.VPCName, -1)
-			//code = strings.Replace(code, "{{GATEWAY_NAME}}", input.GatewayName, -1)
-			//code = strings.Replace(code, "{{SUBNET_NAME}}", input.SubnetName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.RouteName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				Var("route_cidr", input.RouteCIDR).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSSecurityGroup" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_SECURITY_GROUP_TEMPLATE
-			code = strings.Replace(code, "{{SG_NAME}}", input.SGName, -1)
-			code = strings.Replace(code, "{{VPC_NAME}}", input.VPCID, -1)
-			//code = strings.Replace(code, "{{VPC_NAME}}", input.VPCName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.SGName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSSecurityGroupRule" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_SECURITY_GROUP_RULE_TEMPLATE
-			code = strings.Replace(code, "{{SG_RULE_NAME}}", input.SGRuleName, -1)
-			code = strings.Replace(code, "{{SG_NAME}}", input.SGID, -1)
-			//code = strings.Replace(code, "{{SG_NAME}}", input.SGName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.SGRuleName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSKey" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_KEY_TEMPLATE
-			code = strings.Replace(code, "{{KEY_NAME}}", input.KeyName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.KeyName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				AddProvider("tls", tls.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				Var("key_pair", input.KeyName).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSInstance" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_INSTANCE_TEMPLATE
-			code = strings.Replace(code, "{{INS_NAME}}", input.InstanceName, -1)
-			code = strings.Replace(code, "{{SUBNET_ID}}", input.SubnetID, -1)
-			code = strings.Replace(code, "{{SG_ID}}", input.SGID, -1)
-			//code = strings.Replace(code, "{{SUBNET_NAME}}", input.SubnetName, -1)
-			//code = strings.Replace(code, "{{SG_NAME}}", input.SGName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.InstanceName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				AddProvider("tls", tls.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				Var("instance_type", input.InstanceType).
-				Var("image_id", input.ImageID).
-				Var("key_pair", input.KeyName).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else {
-			err = errors.New("Not Found Error: Resource Type")
-			return "", err
-		}
-	} else if input.Cloud == "Azure" { // Platform : Azure
-
-	} else if input.Cloud == "GCP" { // Platform : Google Cloud Platform
-
-	} else if input.Cloud == "OpenStack" { // Platform : OpenStack
-
-	} else if input.Cloud == "VSphere" { // Platform : VSphere
-
+	// The user code is kept in its own files, so the errors show their paths
+	platform := terranova.NewPlatform("")
+	if len(input.HCLFiles) == 0 {
+		platform.AddFile("main.tf", code)
 	} else {
-		err = errors.New("Not Found Error: Cloud Platform")
-		return "", err
+		for path, content := range input.HCLFiles {
+			platform.AddFile(path, content)
+		}
+		// All the files of the loaded modules are checked, not only the
+		// ones of the user code
+		providerFile := filepath.Join(input.HCLRootModule, ProviderFile)
+		platform.AddFile(providerFile, code).
+			SetRootModule(input.HCLRootModule).
+			CheckFilesWith(func(path, content string) error {
+				if path == providerFile {
+					return nil
+				}
+				return checkUserFile(path, content)
+			})
 	}
-
-	// terminate := (count == 0)
-	// Apply brings the platform to the desired state. (Provision / Destroy)
-	if plan, err = platform.Plan(false); err != nil {
-		return "", err
+	platform.BindVars(kind.Vars(input)).
+		LockWith(lock)
+	for name, provider := range kind.Providers() {
+		platform.AddProvider(name, provider)
 	}
 
-	stats = terranova.NewStats().FromPlan(plan)
-
-	status = "provisioned"
-	if stats.Change >= 1 || stats.Destroy >= 1 {
-		status = "chanaged"
+	// Check the rendered code before it's used with the state
+	if err := platform.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid code of %s. %s", input.Type, err)
 	}
-	if stats.Add >= 1 {
-		status = "destroyed"
+
+	platform, err = platform.PersistStateTo(state)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return status, nil
+	return platform, state, nil
 }
 
-// Execute Terraform (Go Package)
-// Provison or Destroy the remote resource
-func ExecuteTerraform(input TerraVars, destroy bool) (string, error) {
-	var platform *terranova.Platform // Platform is the platform to be managed by Terraform
-	var code string                  // HCL (Hashicorp Configuration Language)
-	var filename string
-	var err error
-	var id string
-
-	/*
-		platform, err = terranova.NewPlatform(code). 		// HCL 코드 기반으로 Platform 초기화 (Default Variable)
-		AddProvider("aws", aws.Provider()).					// Provider 추가 (e.g. AWS, Azure, TLS 등)
-		Var("access_key", input.AccessKey).					// HCL 코드 내 변수 설정
-		PersistStateToFile(input.NetworkName + ".tfstate") 	// Terraform State File 설정
-		...
-		platform.Apply(destroy) 							// 설정된 Context 내용 기반으로 클라우드 리소스 생성/삭제 수행
-	*/
+// plan Terraform (Go Package)
+// Returns the changes needed to bring the remote resource to the desired state
+func PlanTerraform(c client.Client, input TerraVars) (*terraformv1alpha1.PlanStatus, error) {
+	platform, _, err := newPlatform(c, input)
+	if err != nil {
+		return nil, err
+	}
 
-	// Define the platform corrensponding to Cloud - Resource type
-	if input.Cloud == "AWS" { // Platform : AWS
-		if input.Type == "AWSVPC" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_VPC_TEMPLATE
-			code = strings.Replace(code, "{{VPC_NAME}}", input.VPCName, -1)
+	plan, err := platform.Plan(false)
+	if err != nil {
+		return nil, err
+	}
 
-			filename = input.Namespace + "-" + input.Type + "-" + input.VPCName + ".tfstate"
+	stats := terranova.NewStats().FromPlan(plan)
+	status := &terraformv1alpha1.PlanStatus{
+		Add:     stats.Add,
+		Change:  stats.Change,
+		Destroy: stats.Destroy,
+		Time:    metav1.Now(),
+	}
 
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				Var("vpc_cidr", input.VPCCIDR).
-				PersistStateToFile(filename)
+	for _, r := range plan.Changes.Resources {
+		// Do not count data resources
+		if r.Addr.Resource.Resource.Mode == addrs.DataResourceMode {
+			continue
+		}
 
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSSubnet" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_SUBNET_TEMPLATE
-			code = strings.Replace(code, "{{SUBNET_NAME}}", input.SubnetName, -1)
-			code = strings.Replace(code, "{{VPC_ID}}", input.VPCID, -1)
-			//code = strings.Replace(code, "{{VPC_NAME}}", input.VPCName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.SubnetName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				Var("subnet_cidr", input.SubnetCIDR).
-				Var("zone", input.Zone).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSGatewy" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_GATEWAY_TEMPLATE
-			code = strings.Replace(code, "{{GATEWAY_NAME}}", input.GatewayName, -1)
-			code = strings.Replace(code, "{{VPC_ID}}", input.VPCID, -1)
-			//code = strings.Replace(code, "{{VPC_NAME}}", input.VPCName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.GatewayName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSRoute" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_ROUTE_TEMPLATE
-			code = strings.Replace(code, "{{ROUTE_NAME}}", input.RouteName, -1)
-			code = strings.Replace(code, "{{VPC_ID}}", input.VPCID, -1)
-			code = strings.Replace(code, "{{GATEWAY_ID}}", input.GatewayID, -1)
-			code = strings.Replace(code, "{{SUBNET_ID}}", input.SubnetID, -1)
-			//code = strings.Replace(code, "{{VPC_NAME}}", input.VPCName, -1)
-			//code = strings.Replace(code, "{{GATEWAY_NAME}}", input.GatewayName, -1)
-			//code = strings.Replace(code, "{{SUBNET_NAME}}", input.SubnetName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.RouteName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				Var("route_cidr", input.RouteCIDR).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSSecurityGroup" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_SECURITY_GROUP_TEMPLATE
-			code = strings.Replace(code, "{{SG_NAME}}", input.SGName, -1)
-			code = strings.Replace(code, "{{VPC_NAME}}", input.VPCID, -1)
-			//code = strings.Replace(code, "{{VPC_NAME}}", input.VPCName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.SGName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSSecurityGroupRule" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_SECURITY_GROUP_RULE_TEMPLATE
-			code = strings.Replace(code, "{{SG_RULE_NAME}}", input.SGRuleName, -1)
-			code = strings.Replace(code, "{{SG_NAME}}", input.SGID, -1)
-			//code = strings.Replace(code, "{{SG_NAME}}", input.SGName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.SGRuleName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSKey" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_KEY_TEMPLATE
-			code = strings.Replace(code, "{{KEY_NAME}}", input.KeyName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.KeyName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				AddProvider("tls", tls.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				Var("key_pair", input.KeyName).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else if input.Type == "AWSInstance" {
-			code = AWS_PROVIDER_TEMPLATE + "\n" + AWS_INSTANCE_TEMPLATE
-			code = strings.Replace(code, "{{INS_NAME}}", input.InstanceName, -1)
-			code = strings.Replace(code, "{{SUBNET_ID}}", input.SubnetID, -1)
-			code = strings.Replace(code, "{{SG_ID}}", input.SGID, -1)
-			//code = strings.Replace(code, "{{SUBNET_NAME}}", input.SubnetName, -1)
-			//code = strings.Replace(code, "{{SG_NAME}}", input.SGName, -1)
-
-			filename = input.Namespace + "-" + input.Type + "-" + input.InstanceName + ".tfstate"
-
-			platform, err = terranova.NewPlatform(code).
-				AddProvider("aws", aws.Provider()).
-				AddProvider("tls", tls.Provider()).
-				Var("access_key", input.AccessKey).
-				Var("secret_key", input.SecretKey).
-				Var("region", input.Region).
-				Var("instance_type", input.InstanceType).
-				Var("image_id", input.ImageID).
-				Var("key_pair", input.KeyName).
-				PersistStateToFile(filename)
-
-			if err != nil {
-				return "", err
-			}
-		} else {
-			err = errors.New("Not Found Error: Resource Type")
-			return "", err
+		var action string
+		switch r.Action {
+		case plans.Create:
+			action = terraformv1alpha1.ActionCreate
+		case plans.Update:
+			action = terraformv1alpha1.ActionUpdate
+		case plans.DeleteThenCreate, plans.CreateThenDelete:
+			action = terraformv1alpha1.ActionReplace
+		case plans.Delete:
+			action = terraformv1alpha1.ActionDelete
+		default:
+			continue
 		}
-	} else if input.Cloud == "Azure" { // Platform : Azure
+		status.Resources = append(status.Resources, terraformv1alpha1.ResourceChange{
+			Address: r.Addr.String(),
+			Action:  action,
+		})
+	}
 
-	} else if input.Cloud == "GCP" { // Platform : Google Cloud Platform
+	return status, nil
+}
 
-	} else if input.Cloud == "OpenStack" { // Platform : OpenStack
+// PlanPhase returns the phase of the resource for its plan: "missing" if a
+// resource has to be created again, "changed" if there are other changes
+func PlanPhase(plan *terraformv1alpha1.PlanStatus) string {
+	status := "provisioned"
+	for _, r := range plan.Resources {
+		if r.Action == terraformv1alpha1.ActionCreate {
+			return "missing"
+		}
+		status = "changed"
+	}
+	return status
+}
 
-	} else if input.Cloud == "VSphere" { // Platform : VSphere
+// Execute Terraform (Go Package)
+// Provison or Destroy the remote resource. Returns the observation of the
+// provisioned resource, nil once it's destroyed.
+func ExecuteTerraform(c client.Client, input TerraVars, destroy bool) (*Observation, error) {
+	var obs *Observation
 
-	} else {
-		err = errors.New("Not Found Error: Cloud Platform")
-		return "", err
+	platform, state, err := newPlatform(c, input)
+	if err != nil {
+		return nil, err
 	}
 
-	// terminate := (count == 0)
 	// Apply brings the platform to the desired state. (Provision / Destroy)
 	if err := platform.Apply(destroy); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if !destroy {
-		if id, err = ReadIDFromFile(filename); err != nil {
-			return "", err
+	if destroy {
+		// Nothing left to track, remove the state
+		if err := state.Delete(); err != nil {
+			return nil, err
+		}
+	} else {
+		if obs, err = observe(platform, input); err != nil {
+			return nil, err
 		}
 	}
 	/*
@@ -831,7 +468,96 @@ func ExecuteTerraform(input TerraVars, destroy bool) (string, error) {
 			return err
 		}
 	*/
-	return id, nil
+	return obs, nil
+}
+
+// Import Terraform (Go Package)
+// Adopts the existing remote resource with the given ID, it's imported into
+// the state instead of being created
+func ImportTerraform(c client.Client, input TerraVars, id string) error {
+	platform, state, err := newPlatform(c, input)
+	if err != nil {
+		return err
+	}
+
+	// The state already tracks the remote resource, e.g. it was provisioned
+	// before the resource could be imported
+	if len(StateResourceIDs(state.State())) != 0 {
+		return nil
+	}
+
+	kind, err := LookupKind(input.Cloud, input.Type)
+	if err != nil {
+		return err
+	}
+	addr := kind.ImportAddress(input)
+	if addr == "" {
+		return fmt.Errorf("Resource Type %q of Cloud Platform %q can't be imported", input.Type, input.Cloud)
+	}
+
+	return platform.Import(addr, id)
+}
+
+// Orphan Terraform (Go Package)
+// Removes the Terraform state of the remote resource, which is kept. Returns
+// the IDs of the orphaned resources.
+func OrphanTerraform(c client.Client, input TerraVars) (ids []string, err error) {
+	name := StateSecretName(input)
+	state := NewSecretState(c, input.Namespace, name, StateOwner(input))
+	lock := NewLeaseLock(c, input.Namespace, name, StateOwner(input))
+
+	info := statemgr.NewLockInfo()
+	info.Operation = "orphan"
+	lockID, err := lock.Lock(info)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if uErr := lock.Unlock(lockID); uErr != nil && err == nil {
+			err = uErr
+		}
+	}()
+
+	if err := state.RefreshState(); err != nil {
+		return nil, err
+	}
+	ids = StateResourceIDs(state.State())
+
+	if err := state.Delete(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// StateResourceIDs returns the sorted IDs of the managed resources of the state
+func StateResourceIDs(state *states.State) []string {
+	var ids []string
+	if state == nil {
+		return ids
+	}
+
+	for _, module := range state.Modules {
+		for _, resource := range module.Resources {
+			if resource.Addr.Mode != addrs.ManagedResourceMode {
+				continue
+			}
+			for _, instance := range resource.Instances {
+				if instance.Current == nil {
+					continue
+				}
+				attrs := map[string]interface{}{}
+				if err := json.Unmarshal(instance.Current.AttrsJSON, &attrs); err != nil {
+					continue
+				}
+				if id, ok := attrs["id"].(string); ok && id != "" {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+
+	sort.Strings(ids)
+	return ids
 }
 
 // Initialize Terraform Working Directory
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/addrs"
+	"github.com/hashicorp/terraform/states"
+	terraformv1alpha1 "github.com/tmax-cloud/terraform-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newResourceState returns a state with an aws_vpc resource for each ID
+func newResourceState(ids ...string) *states.State {
+	state := states.NewState()
+	provider := addrs.ProviderConfig{Type: addrs.NewLegacyProvider("aws")}.Absolute(addrs.RootModuleInstance)
+
+	for _, id := range ids {
+		addr := addrs.Resource{Mode: addrs.ManagedResourceMode, Type: "aws_vpc", Name: id}.Instance(addrs.NoKey)
+		state.RootModule().SetResourceInstanceCurrent(addr, &states.ResourceInstanceObjectSrc{
+			Status:    states.ObjectReady,
+			AttrsJSON: []byte(`{"id":"` + id + `"}`),
+		}, provider)
+	}
+	return state
+}
+
+func TestOrphanTerraform(t *testing.T) {
+	c := fake.NewFakeClientWithScheme(scheme.Scheme)
+	input := TerraVars{Name: "vpc", Namespace: "default", Type: "AWSVPC", Cloud: CloudAWS}
+
+	state := NewSecretState(c, input.Namespace, StateSecretName(input), nil)
+	state.RefreshState()
+	state.WriteState(newResourceState("vpc-2", "vpc-1"))
+	if err := state.PersistState(); err != nil {
+		t.Fatalf("PersistState() error = %v", err)
+	}
+
+	ids, err := OrphanTerraform(c, input)
+	if err != nil {
+		t.Fatalf("OrphanTerraform() error = %v", err)
+	}
+	if want := []string{"vpc-1", "vpc-2"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("OrphanTerraform() = %v, want %v", ids, want)
+	}
+
+	state = NewSecretState(c, input.Namespace, StateSecretName(input), nil)
+	if err := state.RefreshState(); err != nil {
+		t.Fatalf("RefreshState() error = %v", err)
+	}
+	if state.State() != nil {
+		t.Errorf("OrphanTerraform() did not remove the state")
+	}
+}
+
+func TestImportTerraformTracked(t *testing.T) {
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "aws-credentials", Namespace: "default"},
+		Data:       map[string][]byte{"accessKey": []byte("access"), "secretKey": []byte("secret")},
+	}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme, credentials)
+	input := TerraVars{
+		Name:                 "vpc",
+		Namespace:            "default",
+		Type:                 "AWSVPC",
+		Cloud:                CloudAWS,
+		VPCName:              "vpc",
+		CredentialsSecretRef: &terraformv1alpha1.CredentialsSecretRef{Name: credentials.Name},
+	}
+
+	state := NewSecretState(c, input.Namespace, StateSecretName(input), nil)
+	state.RefreshState()
+	state.WriteState(newResourceState("vpc-1"))
+	if err := state.PersistState(); err != nil {
+		t.Fatalf("PersistState() error = %v", err)
+	}
+
+	// The resource is already tracked, so the provider is never called
+	if err := ImportTerraform(c, input, "vpc-2"); err != nil {
+		t.Errorf("ImportTerraform() error = %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// fileFunctions are the Terraform functions reading files. The user code runs
+// in the operator, they would read its files, e.g. the token of its service
+// account.
+var fileFunctions = []string{
+	"file", "filebase64", "fileexists", "fileset", "templatefile",
+	"filemd5", "filesha1", "filesha256", "filesha512", "filebase64sha256", "filebase64sha512",
+}
+
+// credentialVars are the variables of the provider code holding the
+// credentials of the Provider, they're in the root module of the user code
+var credentialVars = []string{"access_key", "secret_key"}
+
+var (
+	jsonFileFunction  = regexp.MustCompile(`\b(` + strings.Join(fileFunctions, "|") + `)\s*\(`)
+	jsonProvider      = regexp.MustCompile(`"provider"\s*:`)
+	jsonCredentialVar = regexp.MustCompile(`\bvar\.(` + strings.Join(credentialVars, "|") + `)\b`)
+)
+
+// checkUserCode returns an error if a file of the user code escapes the
+// sandbox of the operator, see checkUserFile
+func checkUserCode(files map[string]string) error {
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if err := checkUserFile(path, files[path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUserFile returns an error if the file of the user code escapes the
+// sandbox of the operator: it reads files, configures providers, which could
+// use the credentials of the operator, or reads the credentials of the
+// Provider. The syntax errors are left to Terraform.
+func checkUserFile(path, content string) error {
+	if strings.HasSuffix(path, ".tf.json") {
+		return checkUserJSONFile(path, content)
+	}
+
+	file, diags := hclsyntax.ParseConfig([]byte(content), path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil
+	}
+	diags = hclsyntax.VisitAll(file.Body.(*hclsyntax.Body), func(node hclsyntax.Node) hcl.Diagnostics {
+		var summary string
+		switch n := node.(type) {
+		case *hclsyntax.FunctionCallExpr:
+			if isOneOf(n.Name, fileFunctions) {
+				summary = fmt.Sprintf("function %s is not allowed, the code can't read files", n.Name)
+			}
+		case *hclsyntax.ScopeTraversalExpr:
+			if len(n.Traversal) > 1 && n.Traversal.RootName() == "var" {
+				if attr, ok := n.Traversal[1].(hcl.TraverseAttr); ok && isOneOf(attr.Name, credentialVars) {
+					summary = fmt.Sprintf("variable %s is not allowed, it holds the credentials of the Provider", attr.Name)
+				}
+			}
+		case *hclsyntax.Block:
+			switch {
+			case n.Type == "provider":
+				summary = "provider blocks are not allowed, the providers are configured by the operator"
+			case n.Type == "variable" && len(n.Labels) == 1 && isOneOf(n.Labels[0], credentialVars):
+				summary = fmt.Sprintf("variable %s is reserved for the credentials of the Provider", n.Labels[0])
+			}
+		}
+		if summary == "" {
+			return nil
+		}
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  summary,
+			Subject:  node.Range().Ptr(),
+		}}
+	})
+	if diags.HasErrors() {
+		return fmt.Errorf("%s: %s", diags[0].Subject, diags[0].Summary)
+	}
+	return nil
+}
+
+// checkUserJSONFile is checkUserFile for the JSON syntax, whose expressions
+// are in strings
+func checkUserJSONFile(path, content string) error {
+	if m := jsonFileFunction.FindStringSubmatch(content); m != nil {
+		return fmt.Errorf("%s: function %s is not allowed, the code can't read files", path, m[1])
+	}
+	if jsonProvider.MatchString(content) {
+		return fmt.Errorf("%s: provider blocks are not allowed, the providers are configured by the operator", path)
+	}
+	if m := jsonCredentialVar.FindStringSubmatch(content); m != nil {
+		return fmt.Errorf("%s: variable %s is not allowed, it holds the credentials of the Provider", path, m[1])
+	}
+
+	// The variables are an object by name, or an array of such objects
+	var root struct {
+		Variable json.RawMessage `json:"variable"`
+	}
+	if err := json.Unmarshal([]byte(content), &root); err != nil || root.Variable == nil {
+		return nil
+	}
+	var blocks []map[string]json.RawMessage
+	if err := json.Unmarshal(root.Variable, &blocks); err != nil {
+		var block map[string]json.RawMessage
+		if err := json.Unmarshal(root.Variable, &block); err != nil {
+			return nil
+		}
+		blocks = append(blocks, block)
+	}
+	for _, block := range blocks {
+		for name := range block {
+			if isOneOf(name, credentialVars) {
+				return fmt.Errorf("%s: variable %s is reserved for the credentials of the Provider", path, name)
+			}
+		}
+	}
+	return nil
+}
+
+func isOneOf(s string, values []string) bool {
+	for _, v := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}